@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ignoreAnnotation set to "true" on a ConfigMap opts it out of watching:
+	// its events are only logged at debug level and cause no side effects.
+	ignoreAnnotation = "config-watcher/ignore"
+	// restartAnnotation set to "false" on a ConfigMap disables -enable-restart
+	// for it while its references are still logged. On a workload it
+	// overrides -restart-default in either direction.
+	restartAnnotation = "config-watcher/restart"
+)
+
+// boolAnnotation parses the named annotation of obj. ok is false when the
+// annotation is absent or not a boolean; invalid values are logged.
+func boolAnnotation(obj metav1.Object, name string) (value, ok bool) {
+	raw, found := obj.GetAnnotations()[name]
+	if !found {
+		return false, false
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		slog.Warn("Ignoring invalid boolean annotation", "namespace", obj.GetNamespace(), "name", obj.GetName(),
+			"annotation", name, "value", raw)
+		return false, false
+	}
+	return value, true
+}
+
+// configMapIgnored reports whether cm opts out of watching.
+func configMapIgnored(cm *v1.ConfigMap) bool {
+	ignored, ok := boolAnnotation(cm, ignoreAnnotation)
+	return ok && ignored
+}
+
+// workloadRestartPolicy reports whether a workload may be restarted: its
+// restart annotation wins over -restart-default, and with -reloader-compat
+// so do Reloader annotations opting it in for the changed ConfigMap named
+// configMap. policy names the source of the decision for logging.
+func (c *Controller) workloadRestartPolicy(workload metav1.Object, configMap string) (restart bool, policy string) {
+	if restart, ok := boolAnnotation(workload, restartAnnotation); ok {
+		return restart, "annotation"
+	}
+	if c.opts.ReloaderCompat && c.reloaderOptIn(workload, configMap) {
+		return true, "reloader"
+	}
+	return c.opts.RestartDefault, "default"
+}
+
+// configMapRestartDisabled reports whether cm opts out of restarts.
+func configMapRestartDisabled(cm *v1.ConfigMap) bool {
+	restart, ok := boolAnnotation(cm, restartAnnotation)
+	return ok && !restart
+}
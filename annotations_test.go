@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWorkloadRestartPolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		restartDefault bool
+		annotation     string
+		wantRestart    bool
+		wantPolicy     string
+	}{
+		{name: "default on, annotation true", restartDefault: true, annotation: "true", wantRestart: true, wantPolicy: "annotation"},
+		{name: "default on, annotation false", restartDefault: true, annotation: "false", wantRestart: false, wantPolicy: "annotation"},
+		{name: "default off, annotation true", restartDefault: false, annotation: "true", wantRestart: true, wantPolicy: "annotation"},
+		{name: "default off, annotation false", restartDefault: false, annotation: "false", wantRestart: false, wantPolicy: "annotation"},
+		{name: "default on, no annotation", restartDefault: true, wantRestart: true, wantPolicy: "default"},
+		{name: "default off, no annotation", restartDefault: false, wantRestart: false, wantPolicy: "default"},
+		{name: "invalid annotation falls back to default", restartDefault: false, annotation: "yes please", wantRestart: false, wantPolicy: "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, rs, pod := testDeployment("web", volumeSpec("app-config"))
+			if tt.annotation != "" {
+				d.Annotations = map[string]string{restartAnnotation: tt.annotation}
+			}
+			c, clientset := newTestController(t, Options{EnableRestart: true, RestartDefault: tt.restartDefault}, d, rs)
+
+			restart, policy := c.workloadRestartPolicy(d, "app-config")
+			if restart != tt.wantRestart || policy != tt.wantPolicy {
+				t.Errorf("workloadRestartPolicy() = %v, %q, want %v, %q", restart, policy, tt.wantRestart, tt.wantPolicy)
+			}
+
+			cm := testConfigMap("app-config", map[string]string{"level": "info"})
+			if err := c.restartWorkloads(context.Background(), cm, []any{pod}, make(map[workloadRef]bool)); err != nil {
+				t.Fatalf("restartWorkloads: %v", err)
+			}
+			if restarted := len(patchedWorkloads(clientset)) > 0; restarted != tt.wantRestart {
+				t.Errorf("restarted = %v, want %v", restarted, tt.wantRestart)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+type objectRef struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// podReferences explains why a Pod is linked to a ConfigMap.
+type podReferences struct {
+	Namespace  string               `json:"namespace"`
+	Name       string               `json:"name"`
+	References []referenceMechanism `json:"references"`
+}
+
+// referenceMechanism is one way a Pod consumes a ConfigMap. Volume
+// references yield one entry per container mounting the volume.
+type referenceMechanism struct {
+	Mechanism string   `json:"mechanism"`
+	Container string   `json:"container,omitempty"`
+	EnvVar    string   `json:"envVar,omitempty"`
+	Volume    string   `json:"volume,omitempty"`
+	Keys      []string `json:"keys,omitempty"`
+	Optional  bool     `json:"optional,omitempty"`
+	SubPath   bool     `json:"subPath,omitempty"`
+}
+
+type configMapSummary struct {
+	Namespace       string `json:"namespace"`
+	Name            string `json:"name"`
+	ReferencingPods int    `json:"referencingPods"`
+}
+
+func (c *Controller) registerAPI(mux *http.ServeMux) {
+	// Every endpoint answers from the Pod cache and, with -api-token-file,
+	// requires the bearer token
+	if c.opts.ConfigMapOnly {
+		return
+	}
+	mux.HandleFunc("GET /configmaps", c.requireToken(c.requireSynced(c.handleListConfigMaps)))
+	mux.HandleFunc("GET /configmaps/orphans", c.requireToken(c.requireSynced(c.handleOrphanConfigMaps)))
+	mux.HandleFunc("GET /configmaps/{namespace}/{name}/pods", c.requireToken(c.requireSynced(c.handleConfigMapPods)))
+	mux.HandleFunc("GET /pods/{namespace}/{name}/configmaps", c.requireToken(c.requireSynced(c.handlePodConfigMaps)))
+	mux.HandleFunc("GET /nodes/{node}/configmaps", c.requireToken(c.requireSynced(c.handleNodeConfigMaps)))
+}
+
+// requireSynced responds with 503 until the informer caches have synced.
+func (c *Controller) requireSynced(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !c.apiReady() {
+			http.Error(w, "caches are still syncing", http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (c *Controller) handleListConfigMaps(w http.ResponseWriter, r *http.Request) {
+	summaries := []configMapSummary{}
+	for _, obj := range c.configMapInformer.GetStore().List() {
+		cm, ok := obj.(*v1.ConfigMap)
+		if !ok {
+			continue
+		}
+		podKeys, err := c.podKeysReferencingConfigMap(cm.Namespace + "/" + cm.Name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		summaries = append(summaries, configMapSummary{
+			Namespace:       cm.Namespace,
+			Name:            cm.Name,
+			ReferencingPods: len(podKeys),
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Namespace != summaries[j].Namespace {
+			return summaries[i].Namespace < summaries[j].Namespace
+		}
+		return summaries[i].Name < summaries[j].Name
+	})
+
+	writeJSON(w, summaries)
+}
+
+func (c *Controller) handleConfigMapPods(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("namespace") + "/" + r.PathValue("name")
+
+	if r.URL.Query().Get("explain") == "true" {
+		explained, exists, err := c.explainConfigMapPods(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, "configmap "+key+" not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, explained)
+		return
+	}
+
+	refs, exists, err := c.configMapPods(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "configmap "+key+" not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, refs)
+}
+
+func (c *Controller) handlePodConfigMaps(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("namespace") + "/" + r.PathValue("name")
+
+	refs, exists, err := c.podConfigMaps(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, "pod "+key+" not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, refs)
+}
+
+// configMapPods returns the Pods referencing the ConfigMap stored under key,
+// sorted, and whether the ConfigMap is cached.
+func (c *Controller) configMapPods(key string) ([]objectRef, bool, error) {
+	_, exists, err := c.configMapInformer.GetStore().GetByKey(key)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+
+	objs, err := c.podsReferencingConfigMap(key)
+	if err != nil {
+		return nil, true, err
+	}
+	return podRefs(objs), true, nil
+}
+
+// explainConfigMapPods returns the Pods referencing the ConfigMap stored
+// under key, sorted, each with every way it consumes the ConfigMap, and
+// whether the ConfigMap is cached.
+func (c *Controller) explainConfigMapPods(key string) ([]podReferences, bool, error) {
+	_, exists, err := c.configMapInformer.GetStore().GetByKey(key)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+
+	objs, err := c.podsReferencingConfigMap(key)
+	if err != nil {
+		return nil, true, err
+	}
+	_, name, _ := strings.Cut(key, "/")
+	explained := []podReferences{}
+	for _, obj := range objs {
+		pod, ok := obj.(*v1.Pod)
+		if !ok {
+			continue
+		}
+		explained = append(explained, podReferences{
+			Namespace:  pod.Namespace,
+			Name:       pod.Name,
+			References: c.referenceMechanisms(pod, name),
+		})
+	}
+	sort.Slice(explained, func(i, j int) bool {
+		if explained[i].Namespace != explained[j].Namespace {
+			return explained[i].Namespace < explained[j].Namespace
+		}
+		return explained[i].Name < explained[j].Name
+	})
+	return explained, true, nil
+}
+
+// referenceMechanisms lists every reference of pod to the named ConfigMap in
+// spec order.
+func (c *Controller) referenceMechanisms(pod *v1.Pod, name string) []referenceMechanism {
+	mounters := volumeMounters(&pod.Spec)
+	mechanisms := []referenceMechanism{}
+	for _, ref := range append(c.configMapReferences(pod), c.reloaderReferences(pod)...) {
+		if ref.Name != name {
+			continue
+		}
+		m := referenceMechanism{
+			Mechanism: ref.Mechanism,
+			Container: ref.Container,
+			EnvVar:    ref.EnvVar,
+			Volume:    ref.Volume,
+			Keys:      ref.Keys,
+			Optional:  ref.Optional,
+			SubPath:   ref.SubPath,
+		}
+		containers := mounters[ref.Volume]
+		if ref.Volume == "" || len(containers) == 0 {
+			mechanisms = append(mechanisms, m)
+			continue
+		}
+		for _, container := range containers {
+			m.Container = container
+			mechanisms = append(mechanisms, m)
+		}
+	}
+	return mechanisms
+}
+
+// podConfigMaps returns the ConfigMaps referenced by the Pod stored under key
+// and whether the Pod is cached.
+func (c *Controller) podConfigMaps(key string) ([]objectRef, bool, error) {
+	obj, exists, err := c.podInformer.GetStore().GetByKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !exists || !ok {
+		return nil, false, nil
+	}
+
+	refs := []objectRef{}
+	for _, cmKey := range c.referencedConfigMaps(pod) {
+		ns, name, _ := strings.Cut(cmKey, "/")
+		refs = append(refs, objectRef{Namespace: ns, Name: name})
+	}
+	return refs, true, nil
+}
+
+// handleNodeConfigMaps lists the ConfigMaps referenced by the Pods scheduled
+// to a node, each with the number of those Pods referencing it. Nodes are not
+// cached, so an unknown node yields an empty list.
+func (c *Controller) handleNodeConfigMaps(w http.ResponseWriter, r *http.Request) {
+	objs, err := c.podInformer.GetIndexer().ByIndex("nodeName", r.PathValue("node"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, obj := range objs {
+		if pod, ok := obj.(*v1.Pod); ok {
+			for _, key := range c.referencedConfigMaps(pod) {
+				counts[key]++
+			}
+		}
+	}
+
+	summaries := []configMapSummary{}
+	for key, n := range counts {
+		ns, name, _ := strings.Cut(key, "/")
+		summaries = append(summaries, configMapSummary{Namespace: ns, Name: name, ReferencingPods: n})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Namespace != summaries[j].Namespace {
+			return summaries[i].Namespace < summaries[j].Namespace
+		}
+		return summaries[i].Name < summaries[j].Name
+	})
+
+	writeJSON(w, summaries)
+}
+
+func podRefs(objs []any) []objectRef {
+	refs := []objectRef{}
+	for _, obj := range objs {
+		if pod, ok := obj.(*v1.Pod); ok {
+			refs = append(refs, objectRef{Namespace: pod.Namespace, Name: pod.Name})
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Namespace != refs[j].Namespace {
+			return refs[i].Namespace < refs[j].Namespace
+		}
+		return refs[i].Name < refs[j].Name
+	})
+	return refs
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error writing JSON response", "err", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// apiToken holds the bearer token from -api-token-file, reloaded when the
+// file changes so the token can be rotated without a restart.
+type apiToken struct {
+	path  string
+	token atomic.Pointer[[]byte]
+}
+
+// newAPIToken loads the token file, failing if it is unreadable or empty.
+func newAPIToken(path string) (*apiToken, error) {
+	t := &apiToken{path: path}
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// reload reads the token file and swaps the token in. Surrounding
+// whitespace, such as a trailing newline, is ignored.
+func (t *apiToken) reload() error {
+	data, err := os.ReadFile(t.path)
+	if err != nil {
+		return fmt.Errorf("reading API token: %w", err)
+	}
+	token := []byte(strings.TrimSpace(string(data)))
+	if len(token) == 0 {
+		return errors.New("reading API token: " + t.path + " is empty")
+	}
+	t.token.Store(&token)
+	slog.Info("Loaded API token", "path", t.path)
+	return nil
+}
+
+// watch reloads the token whenever the file changes until stopCh is closed.
+func (t *apiToken) watch(stopCh <-chan struct{}) {
+	watchFiles(stopCh, "API token", []string{t.path}, t.reload)
+}
+
+// valid reports whether the Authorization header carries the token.
+func (t *apiToken) valid(header string) bool {
+	given, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(given), *t.token.Load()) == 1
+}
+
+// requireToken responds with 401 unless the request carries the
+// -api-token-file token. Without the flag every request passes; endpoints
+// with side effects use requireConfiguredToken instead.
+func (c *Controller) requireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.apiToken != nil && !c.apiToken.valid(r.Header.Get("Authorization")) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kube-configmap-watcher"`)
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// requireConfiguredToken is requireToken for endpoints with side effects,
+// which answer 403 unless -api-token-file is set.
+func (c *Controller) requireConfiguredToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if c.apiToken == nil {
+			http.Error(w, "disabled without -api-token-file", http.StatusForbidden)
+			return
+		}
+		c.requireToken(next)(w, r)
+	}
+}
+
+// requireTokenUnary is the gRPC counterpart of requireToken, answering
+// UNAUTHENTICATED unless the authorization metadata carries the
+// -api-token-file token.
+func (c *Controller) requireTokenUnary(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if c.apiToken != nil {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) == 0 || !c.apiToken.valid(values[0]) {
+			return nil, status.Error(codes.Unauthenticated, "missing or invalid bearer token")
+		}
+	}
+	return handler(ctx, req)
+}
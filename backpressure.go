@@ -0,0 +1,41 @@
+package main
+
+import "log/slog"
+
+// queuedWork returns the number of ConfigMaps waiting in the work queue plus
+// the handler tasks waiting in the task queue.
+func (c *Controller) queuedWork() int {
+	return c.queue.Len() + c.tasks.Len()
+}
+
+// shedWork reports whether work of the given resource and event type should
+// be dropped instead of queued because MaxQueueDepth items are already
+// queued. Only handler tasks and resyncs are shed: ConfigMap updates are
+// always queued, and event handlers still run their cache-only checks.
+// Shedding starts and stops are logged once each.
+func (c *Controller) shedWork(resource, event string) bool {
+	if c.opts.MaxQueueDepth <= 0 {
+		return false
+	}
+	depth := c.queuedWork()
+	if depth < c.opts.MaxQueueDepth {
+		if c.shedding.CompareAndSwap(true, false) {
+			slog.Info("Work queues below -max-queue-depth, no longer shedding work", "depth", depth, "maxQueueDepth", c.opts.MaxQueueDepth)
+		}
+		return false
+	}
+	if c.shedding.CompareAndSwap(false, true) {
+		slog.Warn("Work queues at -max-queue-depth, shedding handler tasks and resyncs", "depth", depth, "maxQueueDepth", c.opts.MaxQueueDepth)
+	}
+	eventsDropped.WithLabelValues(resource, event).Inc()
+	return true
+}
+
+// addTask queues t, the follow-up of an event of the given resource and
+// type, unless it is shed.
+func (c *Controller) addTask(t task, resource, event string) {
+	if c.shedWork(resource, event) {
+		return
+	}
+	c.tasks.Add(t)
+}
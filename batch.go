@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sort"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// configMapsForPodTemplate returns the deduplicated namespace/name keys of
+// every ConfigMap a pod template references.
+func (c *Controller) configMapsForPodTemplate(namespace string, template *v1.PodTemplateSpec) []string {
+	var keys []string
+	for _, ref := range c.podSpecConfigMapReferences(&template.Spec, template.Annotations) {
+		keys = append(keys, namespace+"/"+ref.Name)
+	}
+	return dedupe(keys)
+}
+
+// configMapRefWorkload indexes Jobs and CronJobs by the ConfigMaps their pod
+// templates reference, so they are known even while no pod runs.
+func (c *Controller) configMapRefWorkload(obj any) ([]string, error) {
+	switch obj := obj.(type) {
+	case *batchv1.Job:
+		return c.configMapsForPodTemplate(obj.Namespace, &obj.Spec.Template), nil
+	case *batchv1.CronJob:
+		return c.configMapsForPodTemplate(obj.Namespace, &obj.Spec.JobTemplate.Spec.Template), nil
+	}
+	return nil, nil
+}
+
+// batchWorkloadsForConfigMap returns the Jobs and CronJobs whose pod templates
+// reference the ConfigMap stored under key, sorted by kind then name.
+func (c *Controller) batchWorkloadsForConfigMap(key string) ([]workloadRef, error) {
+	var refs []workloadRef
+	for _, informer := range []cache.SharedIndexInformer{c.cronJobInformer, c.jobInformer} {
+		objs, err := informer.GetIndexer().ByIndex("configMapRefWorkload", key)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			switch obj := obj.(type) {
+			case *batchv1.Job:
+				refs = append(refs, workloadRef{Kind: "Job", Namespace: obj.Namespace, Name: obj.Name})
+			case *batchv1.CronJob:
+				refs = append(refs, workloadRef{Kind: "CronJob", Namespace: obj.Namespace, Name: obj.Name})
+			}
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Kind != refs[j].Kind {
+			return refs[i].Kind < refs[j].Kind
+		}
+		return refs[i].Name < refs[j].Name
+	})
+	return refs, nil
+}
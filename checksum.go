@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// configMapChecksum returns a SHA-256 over the ConfigMap's Data and
+// BinaryData. Keys are hashed in sorted order so the result only depends on
+// content.
+func configMapChecksum(cm *v1.ConfigMap) string {
+	h := sha256.New()
+
+	keys := make([]string, 0, len(cm.Data))
+	for k := range cm.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeField(h, "data", k, []byte(cm.Data[k]))
+	}
+
+	keys = keys[:0]
+	for k := range cm.BinaryData {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeField(h, "binaryData", k, cm.BinaryData[k])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// configMapSize returns the total size in bytes of the keys and values of
+// the ConfigMap's Data and BinaryData.
+func configMapSize(cm *v1.ConfigMap) int {
+	size := 0
+	for k, v := range cm.Data {
+		size += len(k) + len(v)
+	}
+	for k, v := range cm.BinaryData {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// oversized reports whether the ConfigMap is above -max-diff-size, in which
+// case its content is not compared, diffed or hashed.
+func (c *Controller) oversized(cm *v1.ConfigMap) bool {
+	return c.opts.MaxDiffSize > 0 && configMapSize(cm) > c.opts.MaxDiffSize
+}
+
+// restartChecksum returns the checksum recorded on restarted workloads. For
+// oversized ConfigMaps the resourceVersion stands in for the content hash.
+func (c *Controller) restartChecksum(cm *v1.ConfigMap) string {
+	if c.oversized(cm) {
+		return "resourceVersion:" + cm.ResourceVersion
+	}
+	return configMapChecksum(cm)
+}
+
+// writeField writes a length-prefixed field so that different key/value
+// splits can never produce the same byte stream.
+func writeField(h hash.Hash, section, key string, value []byte) {
+	for _, part := range [][]byte{[]byte(section), []byte(key), value} {
+		_, _ = h.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(part))))
+		_, _ = h.Write(part)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestConfigMapChecksum(t *testing.T) {
+	// fromPairs inserts keys in the given order, which Go maps do not keep
+	fromPairs := func(pairs ...string) map[string]string {
+		data := make(map[string]string)
+		for i := 0; i < len(pairs); i += 2 {
+			data[pairs[i]] = pairs[i+1]
+		}
+		return data
+	}
+	base := testConfigMap("app-config", fromPairs("a", "1", "b", "2", "c", "3", "d", "4", "e", "5"))
+
+	tests := []struct {
+		name string
+		cm   *v1.ConfigMap
+		same bool
+	}{
+		{name: "keys reordered", cm: testConfigMap("app-config", fromPairs("e", "5", "c", "3", "a", "1", "d", "4", "b", "2")), same: true},
+		{
+			name: "metadata changed",
+			cm: func() *v1.ConfigMap {
+				cm := testConfigMap("renamed", fromPairs("d", "4", "b", "2", "e", "5", "a", "1", "c", "3"))
+				cm.ResourceVersion = "7"
+				return cm
+			}(),
+			same: true,
+		},
+		{name: "value changed", cm: testConfigMap("app-config", fromPairs("a", "1", "b", "2", "c", "3", "d", "4", "e", "6")), same: false},
+		{name: "key removed", cm: testConfigMap("app-config", fromPairs("a", "1", "b", "2", "c", "3", "d", "4")), same: false},
+		{name: "key and value split moved", cm: testConfigMap("app-config", fromPairs("a", "1", "b", "2", "c", "3", "d", "4", "e5", "")), same: false},
+		{
+			name: "moved to binaryData",
+			cm: func() *v1.ConfigMap {
+				cm := testConfigMap("app-config", fromPairs("a", "1", "b", "2", "c", "3", "d", "4"))
+				cm.BinaryData = map[string][]byte{"e": []byte("5")}
+				return cm
+			}(),
+			same: false,
+		},
+	}
+	want := configMapChecksum(base)
+	for range 10 {
+		if got := configMapChecksum(testConfigMap("app-config", fromPairs("c", "3", "e", "5", "b", "2", "a", "1", "d", "4"))); got != want {
+			t.Fatalf("checksum not stable across map iteration: %s != %s", got, want)
+		}
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := configMapChecksum(tt.cm); (got == want) != tt.same {
+				t.Errorf("configMapChecksum() = %s, base %s, want same %v", got, want, tt.same)
+			}
+		})
+	}
+}
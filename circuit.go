@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// crashLoopRestartCount is the container restart count from which a pod is
+// considered crash-looping even before kubelet reports CrashLoopBackOff.
+const crashLoopRestartCount = 3
+
+type circuitState string
+
+const (
+	// circuitClosed lets every restart through.
+	circuitClosed circuitState = "closed"
+	// circuitOpen blocks restarts until the cooldown elapses.
+	circuitOpen circuitState = "open"
+	// circuitHalfOpen lets a single probe restart through and closes again
+	// once its pods survive the watch window.
+	circuitHalfOpen circuitState = "half-open"
+)
+
+// restartCircuit is the restart circuit breaker of one ConfigMap.
+type restartCircuit struct {
+	state    circuitState
+	openedAt time.Time
+	probedAt time.Time
+	// restarted maps the workloads restarted for the ConfigMap to the time
+	// of the restart while their new pods are watched.
+	restarted map[workloadRef]time.Time
+}
+
+// circuitAllowsRestart reports whether the circuit of the ConfigMap stored
+// under key lets another workload restart through, advancing the circuit
+// through its states as time passes.
+func (c *Controller) circuitAllowsRestart(ctx context.Context, key string) bool {
+	window := c.opts.RestartCircuitWindow
+	if window <= 0 {
+		return true
+	}
+
+	c.circuitsMu.Lock()
+	defer c.circuitsMu.Unlock()
+
+	cb := c.circuits[key]
+	if cb == nil {
+		return true
+	}
+
+	now := time.Now()
+	for ref, at := range cb.restarted {
+		if now.Sub(at) >= window {
+			delete(cb.restarted, ref)
+		}
+	}
+
+	switch cb.state {
+	case circuitOpen:
+		if now.Sub(cb.openedAt) < c.opts.RestartCircuitCooldown {
+			return false
+		}
+		cb.state = circuitHalfOpen
+		cb.probedAt = time.Time{}
+		loggerFrom(ctx).Info("Restart circuit half-open, allowing a probe restart", "configMap", key)
+		return true
+	case circuitHalfOpen:
+		if cb.probedAt.IsZero() {
+			return true
+		}
+		if now.Sub(cb.probedAt) < window {
+			return false
+		}
+		cb.state = circuitClosed
+		loggerFrom(ctx).Info("Restart circuit closed, probe restart succeeded", "configMap", key)
+	}
+	return true
+}
+
+// circuitOpen reports whether the circuit of the ConfigMap stored under key
+// is open, without advancing it.
+func (c *Controller) circuitOpen(key string) bool {
+	c.circuitsMu.Lock()
+	defer c.circuitsMu.Unlock()
+	cb := c.circuits[key]
+	return cb != nil && cb.state == circuitOpen
+}
+
+// recordCircuitRestart starts watching the new pods of a workload restarted
+// for the ConfigMap stored under key.
+func (c *Controller) recordCircuitRestart(key string, ref workloadRef) {
+	if c.opts.RestartCircuitWindow <= 0 {
+		return
+	}
+
+	c.circuitsMu.Lock()
+	defer c.circuitsMu.Unlock()
+
+	cb := c.circuits[key]
+	if cb == nil {
+		cb = &restartCircuit{state: circuitClosed, restarted: make(map[workloadRef]time.Time)}
+		c.circuits[key] = cb
+	}
+	now := time.Now()
+	cb.restarted[ref] = now
+	if cb.state == circuitHalfOpen && cb.probedAt.IsZero() {
+		cb.probedAt = now
+	}
+}
+
+// checkCrashLoop opens the circuit of every ConfigMap whose restart of the
+// pod's workload, within the watch window, was followed by the pod
+// crash-looping. It runs as a task since resolving the workload may call
+// the API server.
+func (c *Controller) checkCrashLoop(ctx context.Context, pod *v1.Pod) error {
+	if c.opts.RestartCircuitWindow <= 0 || !crashLooping(pod) {
+		return nil
+	}
+
+	c.circuitsMu.Lock()
+	watching := len(c.circuits) > 0
+	c.circuitsMu.Unlock()
+	if !watching {
+		return nil
+	}
+
+	ref, ok, err := c.resolveWorkload(ctx, pod)
+	if err != nil {
+		return fmt.Errorf("resolving owner of Pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	if !ok {
+		return nil
+	}
+
+	c.circuitsMu.Lock()
+	defer c.circuitsMu.Unlock()
+
+	now := time.Now()
+	for key, cb := range c.circuits {
+		at, ok := cb.restarted[ref]
+		if !ok || now.Sub(at) >= c.opts.RestartCircuitWindow {
+			continue
+		}
+		// Only pods created by the restart count; creation timestamps have
+		// second precision
+		if pod.CreationTimestamp.Time.Before(at.Truncate(time.Second)) {
+			continue
+		}
+
+		cb.state = circuitOpen
+		cb.openedAt = now
+		cb.probedAt = time.Time{}
+		clear(cb.restarted)
+		restartCircuitOpen.Inc()
+		slog.Error("Restart circuit opened: Pods are crash-looping after a ConfigMap-triggered restart, pausing restarts for this ConfigMap",
+			"configMap", key, "kind", ref.Kind, "namespace", ref.Namespace, "name", ref.Name, "pod", pod.Name,
+			"cooldown", c.opts.RestartCircuitCooldown)
+	}
+	return nil
+}
+
+// crashLooping reports whether any container of the pod is in
+// CrashLoopBackOff or has restarted repeatedly.
+func crashLooping(pod *v1.Pod) bool {
+	for _, statuses := range [][]v1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.State.Waiting != nil && status.State.Waiting.Reason == "CrashLoopBackOff" {
+				return true
+			}
+			if status.RestartCount >= crashLoopRestartCount {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,442 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// envPrefix prefixes the environment variables that set flags not given on
+// the command line, e.g. KCW_NAMESPACE for -namespace.
+const envPrefix = "KCW_"
+
+// Config holds every setting of the watcher.
+type Config struct {
+	Kubeconfig   string
+	KubeContext  string
+	KubeAPIQPS   float64
+	KubeAPIBurst int
+	UserAgent    string
+
+	Namespace            string
+	Namespaces           []string
+	IgnoreNamespaces     []string
+	OrphanIgnoreNames    []string
+	ReferencedOnly       bool
+	ConfigMapOnly        bool
+	ConfigMapSelector    string
+	PodFieldSelector     string
+	AnnotationRefKeys    []string
+	ReferenceAnnotations []string
+	ReloaderCompat       bool
+	ContainerNames       []string
+	IgnoreOwned          bool
+	IgnoreOwnerKinds     []string
+	ResyncPeriod         time.Duration
+	ResyncJitter         time.Duration
+
+	WatchSecrets    bool
+	WatchBatch      bool
+	WatchData       bool
+	WatchBinaryData bool
+
+	EnableRestart          bool
+	RestartNamespaces      []string
+	RestartDefault         bool
+	RestartStrategy        string
+	RestartStuckPods       bool
+	FieldManager           string
+	RecreateBatchSize      int
+	DryRun                 bool
+	MaxRestartsPerMinute   int
+	RestartCooldown        time.Duration
+	RestartCircuitWindow   time.Duration
+	RestartCircuitCooldown time.Duration
+
+	DebounceWindow time.Duration
+	MaxDiffSize    int
+	Workers        int
+	MaxQueueDepth  int
+
+	WebhookURL       string
+	WebhookTimeout   time.Duration
+	WebhookQueueSize int
+	DigestInterval   time.Duration
+	DigestWebhookURL string
+
+	MirrorConfigMaps []string
+	MirrorDelete     bool
+
+	EnableLeaderElection    bool
+	LeaderElectionNamespace string
+	LeaderElectionID        string
+
+	StartupTimeout          time.Duration
+	CacheSyncTimeout        time.Duration
+	ShutdownTimeout         time.Duration
+	WatchErrorThreshold     int
+	InformerMetricsInterval time.Duration
+
+	MetricsAddr   string
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSMinVersion string
+	APITokenFile  string
+	GRPCAddr      string
+	EnablePprof   bool
+	OTelEndpoint  string
+	ReloadFile    string
+	WatchList     string
+
+	SnapshotDir      string
+	SnapshotInterval time.Duration
+	SnapshotKeep     int
+
+	LogFormat        string
+	LogLevel         string
+	LogPodListLimit  int
+	GroupByOwner     bool
+	PodLogSampleRate int
+
+	Once        bool
+	Version     bool
+	HealthCheck bool
+}
+
+// LoadConfig parses the command line into a Config. Flags not given on the
+// command line are then taken from their KCW_ environment variable when set,
+// and otherwise keep their defaults.
+func LoadConfig() (*Config, error) {
+	cfg := &Config{}
+	ignoreNamespaces := newStringListFlag("kube-system", "kube-node-lease")
+	orphanIgnoreNames := newStringListFlag("kube-root-ca.crt")
+	restartNamespaces := newStringListFlag()
+	namespaces := newStringListFlag()
+	containerNames := newStringListFlag()
+	mirrorConfigMaps := newStringListFlag()
+	ignoreOwnerKinds := newStringListFlag()
+	annotationRefKeys := newStringListFlag()
+	referenceAnnotations := newStringListFlag()
+
+	flag.StringVar(&cfg.Kubeconfig, "kubeconfig", "", "Path to kubeconfig file (optional if running in cluster)")
+	flag.StringVar(&cfg.KubeContext, "context", "", "Kubeconfig context to use (default current context)")
+	flag.Float64Var(&cfg.KubeAPIQPS, "kube-api-qps", 20, "Maximum sustained queries per second to the API server")
+	flag.IntVar(&cfg.KubeAPIBurst, "kube-api-burst", 50, "Maximum burst of queries to the API server above -kube-api-qps")
+	flag.StringVar(&cfg.UserAgent, "user-agent", "kube-configmap-watcher/"+version, "User-Agent sent with API server requests, shown in audit logs")
+	flag.StringVar(&cfg.Namespace, "namespace", "", "Only watch ConfigMaps and Pods in this namespace (default all namespaces)")
+	flag.Var(namespaces, "namespaces", "Comma-separated or repeated list of namespaces to watch ConfigMaps and Pods in, each with its own namespaced informers (default all namespaces)")
+	flag.DurationVar(&cfg.ResyncPeriod, "resync-period", 10*time.Minute, "Informer resync period (0 disables periodic resync)")
+	flag.DurationVar(&cfg.ResyncJitter, "resync-jitter", 30*time.Second, "Maximum random delay spreading out the reconciles queued by SIGUSR1 and POST /resync (0 disables)")
+	flag.StringVar(&cfg.MetricsAddr, "metrics-addr", ":8080", "Address to serve Prometheus metrics, health checks and the query API on")
+	flag.StringVar(&cfg.TLSCertFile, "tls-cert-file", "", "PEM certificate to serve -metrics-addr over HTTPS with, reloaded on change; requires -tls-key-file (default plain HTTP)")
+	flag.StringVar(&cfg.TLSKeyFile, "tls-key-file", "", "PEM private key of -tls-cert-file")
+	flag.StringVar(&cfg.TLSMinVersion, "tls-min-version", "1.2", "Minimum TLS version accepted on -metrics-addr: 1.2 or 1.3")
+	flag.StringVar(&cfg.APITokenFile, "api-token-file", "", "File holding the bearer token required by the query API and POST /resync, reloaded on change (default no authentication, with POST /resync disabled)")
+	flag.StringVar(&cfg.GRPCAddr, "grpc-addr", "", "Address to serve the ReferenceGraph gRPC service on (default disabled)")
+	flag.StringVar(&cfg.SnapshotDir, "snapshot-dir", "", "Directory to periodically write JSON snapshots of the ConfigMap to Pod mapping to (default disabled)")
+	flag.DurationVar(&cfg.SnapshotInterval, "snapshot-interval", 5*time.Minute, "Interval between snapshots written to -snapshot-dir")
+	flag.IntVar(&cfg.SnapshotKeep, "snapshot-keep", 12, "Number of most recent snapshots kept in -snapshot-dir")
+	flag.StringVar(&cfg.OTelEndpoint, "otel-endpoint", "", "OTLP/HTTP URL to export a trace span per ConfigMap reconcile to, e.g. http://otel-collector:4318 (default tracing disabled)")
+	flag.BoolVar(&cfg.EnablePprof, "enable-pprof", false, "Serve runtime profiles under /debug/pprof/ on the metrics address")
+	flag.BoolVar(&cfg.EnableRestart, "enable-restart", false, "Trigger rolling restarts of workloads whose ConfigMap changed")
+	flag.Var(restartNamespaces, "restart-namespaces", "Comma-separated or repeated list of the only namespaces whose workloads are restarted; changes elsewhere are still detected and logged (default all namespaces)")
+	flag.BoolVar(&cfg.RestartDefault, "restart-default", true, "With -enable-restart, restart workloads without a config-watcher/restart annotation")
+	flag.BoolVar(&cfg.RestartStuckPods, "restart-stuck-pods", false, "With -enable-restart, delete Pods stuck in CreateContainerConfigError when a ConfigMap they wait for is created, so their controller replaces them")
+	flag.StringVar(&cfg.FieldManager, "field-manager", "kube-configmap-watcher", "Field manager recorded in managedFields for the pod template annotations set by restarts and for ConfigMap mirrors")
+	flag.StringVar(&cfg.RestartStrategy, "restart-strategy", restartStrategyRollout, "How workloads are restarted: rollout (patch the pod template) or recreate (evict Pods in batches)")
+	flag.IntVar(&cfg.RecreateBatchSize, "recreate-batch-size", 1, "Maximum Pods of one workload being replaced at once with -restart-strategy=recreate")
+	flag.BoolVar(&cfg.DryRun, "dry-run", false, "Log intended workload changes without writing them to the API server")
+	flag.IntVar(&cfg.MaxRestartsPerMinute, "max-restarts-per-minute", 0, "Maximum workload restarts per namespace per minute; excess restarts are deferred (0 disables the limit)")
+	flag.DurationVar(&cfg.RestartCooldown, "restart-cooldown", 60*time.Second, "Minimum time between restarts of the same workload; later triggers are coalesced into the running rollout (0 disables)")
+	flag.DurationVar(&cfg.RestartCircuitWindow, "restart-circuit-window", 5*time.Minute, "How long Pods of a restarted workload are watched for crash loops before other restarts for the same ConfigMap are paused (0 disables)")
+	flag.DurationVar(&cfg.RestartCircuitCooldown, "restart-circuit-cooldown", 10*time.Minute, "How long restarts for a ConfigMap stay paused after crash-looping Pods before a probe restart is tried")
+	flag.BoolVar(&cfg.WatchSecrets, "watch-secrets", false, "Also watch Secrets and index Pods referencing them (requires Secret RBAC)")
+	flag.BoolVar(&cfg.WatchData, "watch-data", true, "Treat changes to a ConfigMap's data as meaningful updates")
+	flag.BoolVar(&cfg.WatchBinaryData, "watch-binary-data", true, "Treat changes to a ConfigMap's binaryData as meaningful updates")
+	flag.BoolVar(&cfg.WatchBatch, "watch-batch", false, "Also watch Jobs and CronJobs and report those whose pod templates reference a changed ConfigMap (requires batch RBAC)")
+	flag.Var(annotationRefKeys, "annotation-ref-key", "Comma-separated or repeated list of Pod annotations holding comma-separated names of ConfigMaps the Pod depends on")
+	flag.Var(referenceAnnotations, "reference-annotations", "Comma-separated or repeated list of Deployment, StatefulSet and DaemonSet annotations holding comma-separated names of ConfigMaps their Pods depend on")
+	flag.BoolVar(&cfg.ReloaderCompat, "reloader-compat", false, "Also read ConfigMap dependencies and restart opt-ins from the workload annotations used by Stakater Reloader: adds configmap.reloader.stakater.com/reload to -reference-annotations and honours reloader.stakater.com/auto")
+	flag.Var(containerNames, "container-names", "Comma-separated or repeated list of the only containers whose env and envFrom ConfigMap references are indexed; volume references are unaffected (default all containers)")
+	flag.Var(ignoreNamespaces, "ignore-namespaces", "Comma-separated or repeated list of namespaces whose objects are ignored by all handlers")
+	flag.BoolVar(&cfg.IgnoreOwned, "ignore-owned-configmaps", false, "Ignore ConfigMaps with any ownerReference, such as those managed by operators")
+	flag.Var(ignoreOwnerKinds, "ignore-owner-kinds", "Comma-separated or repeated list of owner kinds (e.g. Prometheus) whose ConfigMaps are ignored")
+	flag.BoolVar(&cfg.ConfigMapOnly, "configmap-only", false, "Run without watching Pods, only logging ConfigMap changes (for service accounts without Pod RBAC)")
+	flag.BoolVar(&cfg.ReferencedOnly, "referenced-only", false, "Skip add, update and delete events of ConfigMaps no Pod references (best effort)")
+	flag.Var(orphanIgnoreNames, "orphan-ignore-names", "Comma-separated or repeated list of ConfigMap names never reported by /configmaps/orphans")
+	flag.StringVar(&cfg.PodFieldSelector, "pod-field-selector", "", "Field selector restricting which Pods are watched (e.g. status.phase!=Succeeded)")
+	flag.StringVar(&cfg.ConfigMapSelector, "configmap-selector", "", "Label selector restricting which ConfigMaps are watched (e.g. watch=true)")
+	flag.DurationVar(&cfg.DebounceWindow, "debounce-window", 5*time.Second, "Collapse updates to the same ConfigMap within this window into a single reconcile")
+	flag.IntVar(&cfg.MaxDiffSize, "max-diff-size", 512*1024, "ConfigMap data size in bytes above which updates are not diffed or checksummed but always treated as changes (0 disables)")
+	flag.StringVar(&cfg.WebhookURL, "webhook-url", "", "URL to POST a JSON notification to when a ConfigMap's content changes")
+	flag.DurationVar(&cfg.DigestInterval, "digest-interval", 0, "Window over which ConfigMap changes are summarized in a single digest log line, in addition to per-event logs (0 disables)")
+	flag.StringVar(&cfg.DigestWebhookURL, "digest-webhook-url", "", "URL to POST each -digest-interval digest to as JSON")
+	flag.Var(mirrorConfigMaps, "mirror-configmap", "Comma-separated or repeated rules of the form namespace/name -> namespace/name copying the data and binaryData of a watched ConfigMap to another one, created if missing")
+	flag.BoolVar(&cfg.MirrorDelete, "mirror-delete", false, "Delete -mirror-configmap targets when their source ConfigMap is deleted")
+	flag.DurationVar(&cfg.WebhookTimeout, "webhook-timeout", 5*time.Second, "Timeout for each webhook request")
+	flag.IntVar(&cfg.WebhookQueueSize, "webhook-queue-size", 1000, "Maximum webhook notifications waiting to be sent, and separately waiting to be retried; notifications over the limit are logged as dead letters")
+	flag.IntVar(&cfg.Workers, "workers", 2, "Number of workers processing ConfigMap updates")
+	flag.IntVar(&cfg.MaxQueueDepth, "max-queue-depth", 1000, "Number of queued ConfigMaps and handler tasks at which new handler tasks and resyncs are shed; ConfigMap updates are always queued (0 never sheds)")
+	flag.BoolVar(&cfg.EnableLeaderElection, "enable-leader-election", false, "Use a Lease so only one replica runs the informers and handlers")
+	flag.StringVar(&cfg.LeaderElectionNamespace, "leader-election-namespace", "configmap-watcher", "Namespace of the leader election Lease")
+	flag.StringVar(&cfg.LeaderElectionID, "leader-election-id", "kube-configmap-watcher", "Name of the leader election Lease")
+	flag.DurationVar(&cfg.StartupTimeout, "startup-timeout", 60*time.Second, "Maximum time to wait for the API server to become reachable at startup")
+	flag.DurationVar(&cfg.CacheSyncTimeout, "cache-sync-timeout", 5*time.Minute, "Maximum time to wait for the informer caches to sync before exiting with code 2")
+	flag.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "Maximum time to wait for queued work to drain on shutdown before in-flight API calls are cancelled, and then for pending webhooks to be sent")
+	flag.BoolVar(&cfg.Once, "once", false, "Print the ConfigMap to Pod mapping once caches sync, then exit")
+	flag.IntVar(&cfg.WatchErrorThreshold, "watch-error-threshold", 5, "Consecutive watch errors without progress after which /readyz reports not ready")
+	flag.DurationVar(&cfg.InformerMetricsInterval, "informer-metrics-interval", 30*time.Second, "Interval at which informer cache size and last sync metrics are sampled")
+	flag.BoolVar(&cfg.Version, "version", false, "Print version information and exit")
+	flag.BoolVar(&cfg.HealthCheck, "health-check", false, "Query /readyz of the local watcher and exit 0 if ready, 1 otherwise")
+	hiddenFlags["health-check"] = true
+	flag.IntVar(&cfg.LogPodListLimit, "log-pod-list-limit", 20, "Maximum number of referencing Pods logged per update; the rest are summarized (0 logs all)")
+	flag.BoolVar(&cfg.GroupByOwner, "group-by-owner", false, "Log Pods referencing a changed ConfigMap or Secret as one line per owning workload with its Pod count; Pods without a controller are still logged one by one")
+	flag.IntVar(&cfg.PodLogSampleRate, "pod-log-sample-rate", 0, "Maximum Pod add, update and delete lines logged per second; the rest are counted in a periodic summary (0 logs all)")
+	flag.StringVar(&cfg.WatchList, "watch-list", "", "YAML or JSON file listing the {namespace, name} of the only ConfigMaps to handle, reloaded on change (default all ConfigMaps)")
+	flag.StringVar(&cfg.ReloadFile, "reload-file", "", "File of name=value settings (log-level, debounce-window, dry-run) re-read on SIGHUP")
+	flag.StringVar(&cfg.LogFormat, "log-format", "text", "Log output format: text or json")
+	flag.StringVar(&cfg.LogLevel, "log-level", "info", "Minimum log level: debug, info, warn or error")
+	flag.Usage = usage
+	flag.Parse()
+
+	if err := applyEnv(flag.CommandLine); err != nil {
+		return nil, err
+	}
+	cfg.Namespaces = namespaces.values
+	cfg.ContainerNames = containerNames.values
+	cfg.MirrorConfigMaps = mirrorConfigMaps.values
+	cfg.IgnoreOwnerKinds = ignoreOwnerKinds.values
+	cfg.AnnotationRefKeys = annotationRefKeys.values
+	cfg.ReferenceAnnotations = referenceAnnotations.values
+	cfg.IgnoreNamespaces = ignoreNamespaces.values
+	cfg.OrphanIgnoreNames = orphanIgnoreNames.values
+	cfg.RestartNamespaces = restartNamespaces.values
+	return cfg, nil
+}
+
+// envName returns the environment variable for a flag name.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// applyEnv sets every flag of fs not given on the command line from its
+// environment variable, if present.
+func applyEnv(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] {
+			return
+		}
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok {
+			return
+		}
+		if err := fs.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: %w", envName(f.Name), value, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// Validate checks the invariants of cfg and reports every violation.
+func (cfg *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, flagName, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("invalid -%s: %s", flagName, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	check(cfg.KubeAPIQPS > 0, "kube-api-qps", "must be positive, got %g", cfg.KubeAPIQPS)
+	check(cfg.KubeAPIBurst >= 1, "kube-api-burst", "must be at least 1, got %d", cfg.KubeAPIBurst)
+	check(cfg.ResyncPeriod >= 0, "resync-period", "must not be negative, got %s", cfg.ResyncPeriod)
+	check(cfg.ResyncJitter >= 0, "resync-jitter", "must not be negative, got %s", cfg.ResyncJitter)
+	check(cfg.StartupTimeout > 0, "startup-timeout", "must be positive, got %s", cfg.StartupTimeout)
+	check(cfg.CacheSyncTimeout > 0, "cache-sync-timeout", "must be positive, got %s", cfg.CacheSyncTimeout)
+	check(cfg.ShutdownTimeout >= 0, "shutdown-timeout", "must not be negative, got %s", cfg.ShutdownTimeout)
+	check(cfg.DebounceWindow >= 0, "debounce-window", "must not be negative, got %s", cfg.DebounceWindow)
+	check(cfg.MaxDiffSize >= 0, "max-diff-size", "must not be negative, got %d", cfg.MaxDiffSize)
+	check(cfg.MaxRestartsPerMinute >= 0, "max-restarts-per-minute", "must not be negative, got %d", cfg.MaxRestartsPerMinute)
+	check(cfg.RestartStrategy == restartStrategyRollout || cfg.RestartStrategy == restartStrategyRecreate, "restart-strategy",
+		"must be %s or %s, got %q", restartStrategyRollout, restartStrategyRecreate, cfg.RestartStrategy)
+	check(!cfg.RestartStuckPods || cfg.EnableRestart, "restart-stuck-pods", "requires -enable-restart")
+	check(cfg.FieldManager != "" && len(cfg.FieldManager) <= 128, "field-manager", "must be 1 to 128 characters, got %q", cfg.FieldManager)
+	check(cfg.RecreateBatchSize >= 1, "recreate-batch-size", "must be at least 1, got %d", cfg.RecreateBatchSize)
+	check(cfg.RestartCooldown >= 0, "restart-cooldown", "must not be negative, got %s", cfg.RestartCooldown)
+	check(cfg.RestartCircuitWindow >= 0, "restart-circuit-window", "must not be negative, got %s", cfg.RestartCircuitWindow)
+	check(cfg.RestartCircuitCooldown >= 0, "restart-circuit-cooldown", "must not be negative, got %s", cfg.RestartCircuitCooldown)
+	check(cfg.InformerMetricsInterval > 0, "informer-metrics-interval", "must be positive, got %s", cfg.InformerMetricsInterval)
+	check(cfg.LogPodListLimit >= 0, "log-pod-list-limit", "must not be negative, got %d", cfg.LogPodListLimit)
+	check(cfg.PodLogSampleRate >= 0, "pod-log-sample-rate", "must not be negative, got %d", cfg.PodLogSampleRate)
+	check(cfg.DigestInterval >= 0, "digest-interval", "must not be negative, got %s", cfg.DigestInterval)
+	check(cfg.DigestWebhookURL == "" || cfg.DigestInterval > 0, "digest-webhook-url", "requires -digest-interval")
+	check(cfg.WebhookTimeout > 0, "webhook-timeout", "must be positive, got %s", cfg.WebhookTimeout)
+	check(cfg.WebhookQueueSize >= 1, "webhook-queue-size", "must be at least 1, got %d", cfg.WebhookQueueSize)
+	check((cfg.TLSCertFile == "") == (cfg.TLSKeyFile == ""), "tls-cert-file", "must be set together with -tls-key-file")
+	_, ok := tlsVersions[cfg.TLSMinVersion]
+	check(ok, "tls-min-version", "must be 1.2 or 1.3, got %q", cfg.TLSMinVersion)
+	check(cfg.Workers >= 1, "workers", "must be at least 1, got %d", cfg.Workers)
+	check(cfg.MaxQueueDepth >= 0, "max-queue-depth", "must not be negative, got %d", cfg.MaxQueueDepth)
+	check(cfg.LogFormat == "text" || cfg.LogFormat == "json", "log-format", "must be text or json, got %q", cfg.LogFormat)
+
+	check(cfg.Namespace == "" || len(cfg.Namespaces) == 0, "namespaces", "cannot be combined with -namespace")
+	for _, ns := range cfg.Namespaces {
+		check(!slices.Contains(cfg.IgnoreNamespaces, ns), "namespaces", "%s is also listed in -ignore-namespaces", ns)
+	}
+	check(!cfg.IgnoreOwned || len(cfg.IgnoreOwnerKinds) == 0, "ignore-owner-kinds", "cannot be combined with -ignore-owned-configmaps, which ignores every owner")
+	check(len(cfg.MirrorConfigMaps) > 0 || !cfg.MirrorDelete, "mirror-delete", "requires -mirror-configmap")
+	sources := make(map[objectRef]bool)
+	targets := make(map[objectRef]bool)
+	var uniqueTargets []objectRef
+	for _, raw := range cfg.MirrorConfigMaps {
+		rule, err := parseMirrorRule(raw)
+		if err != nil {
+			check(false, "mirror-configmap", "%v", err)
+			continue
+		}
+		sources[rule.Source] = true
+		if targets[rule.Target] {
+			check(false, "mirror-configmap", "%s/%s is the target of more than one rule", rule.Target.Namespace, rule.Target.Name)
+		} else {
+			uniqueTargets = append(uniqueTargets, rule.Target)
+		}
+		targets[rule.Target] = true
+		ns := rule.Source.Namespace
+		watched := (cfg.Namespace == "" || cfg.Namespace == ns) && (len(cfg.Namespaces) == 0 || slices.Contains(cfg.Namespaces, ns)) &&
+			!slices.Contains(cfg.IgnoreNamespaces, ns)
+		check(watched, "mirror-configmap", "source %s/%s is in a namespace that is not watched", ns, rule.Source.Name)
+	}
+	// Chained rules would need mirrors to be mirrored, which the
+	// mirrored-from annotation prevents
+	for _, target := range uniqueTargets {
+		check(!sources[target], "mirror-configmap", "target %s/%s is also a source", target.Namespace, target.Name)
+	}
+	check(!cfg.ConfigMapOnly || !cfg.EnableRestart, "configmap-only", "cannot be combined with -enable-restart, which needs Pods")
+	check(!cfg.ConfigMapOnly || !cfg.ReferencedOnly, "configmap-only", "cannot be combined with -referenced-only, which needs Pods")
+	check(!cfg.ConfigMapOnly || cfg.GRPCAddr == "", "configmap-only", "cannot be combined with -grpc-addr, which needs Pods")
+	check(!cfg.ConfigMapOnly || cfg.SnapshotDir == "", "configmap-only", "cannot be combined with -snapshot-dir, which needs Pods")
+	check(cfg.SnapshotInterval > 0, "snapshot-interval", "must be positive, got %s", cfg.SnapshotInterval)
+	check(cfg.SnapshotKeep >= 1, "snapshot-keep", "must be at least 1, got %d", cfg.SnapshotKeep)
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		check(false, "log-level", "%v", err)
+	}
+	if _, err := labels.Parse(cfg.ConfigMapSelector); err != nil {
+		check(false, "configmap-selector", "%v", err)
+	}
+	if _, err := fields.ParseSelector(cfg.PodFieldSelector); err != nil {
+		check(false, "pod-field-selector", "%v", err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// ControllerOptions converts a validated Config into controller Options.
+func (cfg *Config) ControllerOptions() (Options, error) {
+	configMapSelector, err := labels.Parse(cfg.ConfigMapSelector)
+	if err != nil {
+		return Options{}, fmt.Errorf("parsing -configmap-selector: %w", err)
+	}
+	podFieldSelector, err := fields.ParseSelector(cfg.PodFieldSelector)
+	if err != nil {
+		return Options{}, fmt.Errorf("parsing -pod-field-selector: %w", err)
+	}
+
+	referenceAnnotations := slices.Clone(cfg.ReferenceAnnotations)
+	if cfg.ReloaderCompat {
+		referenceAnnotations = append(referenceAnnotations, reloaderAnnotationKeys...)
+	}
+	referenceAnnotations = dedupe(referenceAnnotations)
+
+	var mirrorRules []mirrorRule
+	for _, raw := range cfg.MirrorConfigMaps {
+		rule, err := parseMirrorRule(raw)
+		if err != nil {
+			return Options{}, fmt.Errorf("parsing -mirror-configmap: %w", err)
+		}
+		mirrorRules = append(mirrorRules, rule)
+	}
+
+	return Options{
+		Namespace:               cfg.Namespace,
+		Namespaces:              cfg.Namespaces,
+		ResyncPeriod:            cfg.ResyncPeriod,
+		ResyncJitter:            cfg.ResyncJitter,
+		IgnoredNamespaces:       cfg.IgnoreNamespaces,
+		OrphanIgnoreNames:       cfg.OrphanIgnoreNames,
+		ReferencedOnly:          cfg.ReferencedOnly,
+		ConfigMapOnly:           cfg.ConfigMapOnly,
+		ConfigMapSelector:       configMapSelector,
+		PodFieldSelector:        podFieldSelector,
+		AnnotationRefKeys:       dedupe(slices.Clone(cfg.AnnotationRefKeys)),
+		ReferenceAnnotations:    referenceAnnotations,
+		ReloaderCompat:          cfg.ReloaderCompat,
+		ContainerNames:          cfg.ContainerNames,
+		IgnoreOwnedConfigMaps:   cfg.IgnoreOwned,
+		IgnoreOwnerKinds:        cfg.IgnoreOwnerKinds,
+		WatchSecrets:            cfg.WatchSecrets,
+		WatchData:               cfg.WatchData,
+		WatchBinaryData:         cfg.WatchBinaryData,
+		WatchBatch:              cfg.WatchBatch,
+		EnableRestart:           cfg.EnableRestart,
+		RestartNamespaces:       cfg.RestartNamespaces,
+		RestartDefault:          cfg.RestartDefault,
+		RestartStrategy:         cfg.RestartStrategy,
+		RestartStuckPods:        cfg.RestartStuckPods,
+		FieldManager:            cfg.FieldManager,
+		RecreateBatchSize:       cfg.RecreateBatchSize,
+		DryRun:                  cfg.DryRun,
+		MaxRestartsPerMinute:    cfg.MaxRestartsPerMinute,
+		RestartCooldown:         cfg.RestartCooldown,
+		RestartCircuitWindow:    cfg.RestartCircuitWindow,
+		RestartCircuitCooldown:  cfg.RestartCircuitCooldown,
+		DebounceWindow:          cfg.DebounceWindow,
+		MaxDiffSize:             cfg.MaxDiffSize,
+		Workers:                 cfg.Workers,
+		MaxQueueDepth:           cfg.MaxQueueDepth,
+		WebhookURL:              cfg.WebhookURL,
+		WebhookTimeout:          cfg.WebhookTimeout,
+		WebhookQueueSize:        cfg.WebhookQueueSize,
+		MirrorConfigMaps:        mirrorRules,
+		MirrorDelete:            cfg.MirrorDelete,
+		DigestInterval:          cfg.DigestInterval,
+		DigestWebhookURL:        cfg.DigestWebhookURL,
+		LogPodListLimit:         cfg.LogPodListLimit,
+		GroupByOwner:            cfg.GroupByOwner,
+		PodLogSampleRate:        cfg.PodLogSampleRate,
+		WatchErrorThreshold:     cfg.WatchErrorThreshold,
+		InformerMetricsInterval: cfg.InformerMetricsInterval,
+		StartupTimeout:          cfg.StartupTimeout,
+		CacheSyncTimeout:        cfg.CacheSyncTimeout,
+		ShutdownTimeout:         cfg.ShutdownTimeout,
+		MetricsAddr:             cfg.MetricsAddr,
+		TLSCertFile:             cfg.TLSCertFile,
+		TLSKeyFile:              cfg.TLSKeyFile,
+		TLSMinVersion:           tlsVersions[cfg.TLSMinVersion],
+		APITokenFile:            cfg.APITokenFile,
+		GRPCAddr:                cfg.GRPCAddr,
+		SnapshotDir:             cfg.SnapshotDir,
+		SnapshotInterval:        cfg.SnapshotInterval,
+		SnapshotKeep:            cfg.SnapshotKeep,
+		EnablePprof:             cfg.EnablePprof,
+		ReloadFile:              cfg.ReloadFile,
+		WatchListFile:           cfg.WatchList,
+		EnableLeaderElection:    cfg.EnableLeaderElection,
+		LeaderElectionNamespace: cfg.LeaderElectionNamespace,
+		LeaderElectionID:        cfg.LeaderElectionID,
+	}, nil
+}
@@ -0,0 +1,838 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// podListPageSize is the page size used when listing Pods, keeping the
+// initial list of large clusters in bounded chunks.
+const podListPageSize = 500
+
+// Options configures a Controller.
+type Options struct {
+	// Namespace limits every informer to one namespace; empty means all.
+	Namespace string
+	// Namespaces watches each listed namespace with its own namespaced
+	// informers instead of one namespace or the whole cluster.
+	Namespaces   []string
+	ResyncPeriod time.Duration
+	// ResyncJitter is the maximum random delay before each reconcile queued
+	// by resyncAll.
+	ResyncJitter time.Duration
+	// IgnoredNamespaces lists namespaces whose objects no handler sees.
+	IgnoredNamespaces []string
+	// ReferencedOnly skips ConfigMaps that no cached Pod references.
+	ReferencedOnly bool
+	// ConfigMapOnly runs without watching Pods, only logging ConfigMap
+	// changes.
+	ConfigMapOnly bool
+	// OrphanIgnoreNames lists ConfigMap names never reported as orphans.
+	OrphanIgnoreNames []string
+	ConfigMapSelector labels.Selector
+	PodFieldSelector  fields.Selector
+	// AnnotationRefKeys names the Pod annotations listing extra ConfigMap
+	// dependencies; empty disables annotation references.
+	AnnotationRefKeys []string
+	// ReferenceAnnotations names the Deployment, StatefulSet and DaemonSet
+	// annotations listing ConfigMaps their Pods depend on.
+	ReferenceAnnotations []string
+	// ReloaderCompat lets Stakater Reloader's auto annotations, and the
+	// ReferenceAnnotations naming the changed ConfigMap, opt workloads into
+	// restarts. Config appends Reloader's reload annotation to
+	// ReferenceAnnotations with it.
+	ReloaderCompat bool
+	// ContainerNames limits env and envFrom references to the named
+	// containers; empty means every container.
+	ContainerNames []string
+	// IgnoreOwnedConfigMaps skips ConfigMaps with any owner reference, and
+	// IgnoreOwnerKinds those with an owner of one of the listed kinds.
+	IgnoreOwnedConfigMaps bool
+	IgnoreOwnerKinds      []string
+
+	WatchSecrets bool
+	WatchBatch   bool
+	// WatchData and WatchBinaryData select which ConfigMap fields count
+	// when deciding whether an update changed anything.
+	WatchData       bool
+	WatchBinaryData bool
+
+	EnableRestart bool
+	// RestartNamespaces, when not empty, limits restarts to workloads in
+	// these namespaces.
+	RestartNamespaces []string
+	// RestartDefault decides whether workloads without a restart annotation
+	// are restarted.
+	RestartDefault bool
+	// FieldManager is recorded in managedFields for the fields the restart
+	// patches and ConfigMap mirrors write.
+	FieldManager string
+	// RestartStuckPods deletes Pods stuck in CreateContainerConfigError when
+	// a ConfigMap they wait for is created.
+	RestartStuckPods bool
+	// RestartStrategy is restartStrategyRollout or restartStrategyRecreate.
+	RestartStrategy string
+	// RecreateBatchSize caps the pods of one workload replaced at once by the
+	// recreate strategy.
+	RecreateBatchSize    int
+	DryRun               bool
+	MaxRestartsPerMinute int
+	// RestartCooldown is the minimum time between restarts of one workload;
+	// 0 disables it.
+	RestartCooldown time.Duration
+	// RestartCircuitWindow is how long the pods of a restarted workload are
+	// watched for crash loops; 0 disables the circuit breaker.
+	RestartCircuitWindow   time.Duration
+	RestartCircuitCooldown time.Duration
+
+	DebounceWindow time.Duration
+	// MaxDiffSize is the ConfigMap data size in bytes above which content
+	// is neither compared, diffed nor checksummed; 0 disables the limit.
+	MaxDiffSize int
+	Workers     int
+	// MaxQueueDepth is the number of queued ConfigMaps at which Pod add
+	// and delete events are shed; 0 never sheds.
+	MaxQueueDepth int
+
+	WebhookURL     string
+	WebhookTimeout time.Duration
+	// WebhookQueueSize bounds the notifications waiting to be sent, and
+	// separately those waiting to be retried.
+	WebhookQueueSize int
+	// MirrorConfigMaps copies the data of each rule's source ConfigMap to
+	// its target, and MirrorDelete deletes the target with the source.
+	MirrorConfigMaps []mirrorRule
+	MirrorDelete     bool
+	// DigestInterval is the window over which ConfigMap changes are
+	// summarized in one digest, sent to DigestWebhookURL when set; 0
+	// disables digests.
+	DigestInterval   time.Duration
+	DigestWebhookURL string
+
+	LogPodListLimit int
+	// GroupByOwner logs referencing Pods per top-level owning workload.
+	GroupByOwner bool
+	// PodLogSampleRate caps the Pod event lines logged per second; 0 logs
+	// every event.
+	PodLogSampleRate    int
+	WatchErrorThreshold int
+	StartupTimeout      time.Duration
+	CacheSyncTimeout    time.Duration
+	ShutdownTimeout     time.Duration
+	// InformerMetricsInterval is how often the informer cache gauges are
+	// sampled.
+	InformerMetricsInterval time.Duration
+
+	// MetricsAddr is the address of the metrics, health and API server.
+	MetricsAddr string
+	// TLSCertFile and TLSKeyFile serve MetricsAddr over HTTPS, accepting
+	// TLSMinVersion and up; empty serves plain HTTP.
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSMinVersion uint16
+	// APITokenFile holds the bearer token the query API and POST /resync
+	// require; empty leaves them open.
+	APITokenFile string
+	// GRPCAddr is the address of the ReferenceGraph gRPC server; empty
+	// disables it.
+	GRPCAddr string
+	// SnapshotDir receives a reference graph snapshot every
+	// SnapshotInterval, keeping the newest SnapshotKeep; empty disables
+	// snapshots.
+	SnapshotDir      string
+	SnapshotInterval time.Duration
+	SnapshotKeep     int
+	// EnablePprof serves runtime profiles under /debug/pprof/ on MetricsAddr.
+	EnablePprof bool
+	// ReloadFile is re-read on SIGHUP when set.
+	ReloadFile string
+	// WatchListFile restricts handled ConfigMaps to those it lists and is
+	// reloaded when it changes.
+	WatchListFile string
+
+	EnableLeaderElection    bool
+	LeaderElectionNamespace string
+	LeaderElectionID        string
+}
+
+// Controller watches ConfigMaps and the Pods referencing them and reacts to
+// ConfigMap changes.
+type Controller struct {
+	opts Options
+
+	clientset        kubernetes.Interface
+	eventBroadcaster record.EventBroadcaster
+	recorder         record.EventRecorder
+
+	factories []namespaceFactories
+
+	configMapInformer  cache.SharedIndexInformer
+	podInformer        cache.SharedIndexInformer
+	secretInformer     cache.SharedIndexInformer
+	jobInformer        cache.SharedIndexInformer
+	cronJobInformer    cache.SharedIndexInformer
+	deploymentInformer cache.SharedIndexInformer
+	replicaSetInformer cache.SharedIndexInformer
+	// statefulSetInformer and daemonSetInformer are only set with
+	// readsWorkloadAnnotations.
+	statefulSetInformer cache.SharedIndexInformer
+	daemonSetInformer   cache.SharedIndexInformer
+
+	ignoredNamespaces map[string]bool
+	// restartNamespaces holds RestartNamespaces; nil allows every namespace.
+	restartNamespaces map[string]bool
+	// containerNames holds ContainerNames; nil allows every container.
+	containerNames map[string]bool
+	// ignoredOwnerKinds holds IgnoreOwnerKinds.
+	ignoredOwnerKinds map[string]bool
+	// configMapsFiltered is set when a label selector hides some ConfigMaps
+	// from the cache.
+	configMapsFiltered bool
+
+	queue workqueue.TypedRateLimitingInterface[string]
+	// webhooks sends -webhook-url and -digest-webhook-url notifications;
+	// nil when neither is set.
+	webhooks *webhookNotifier
+	// mirrors lists, per source ConfigMap key, the targets of its
+	// -mirror-configmap rules, and mirrorQueue holds the sources waiting to
+	// be mirrored; both are nil without rules.
+	mirrors     map[string][]objectRef
+	mirrorQueue workqueue.TypedRateLimitingInterface[string]
+	// tasks holds the follow-up work of event handlers that may call the
+	// API server.
+	tasks workqueue.TypedRateLimitingInterface[task]
+	// certs serves the HTTPS certificate when TLSCertFile is set.
+	certs *certReloader
+	// digest accumulates changes for the next digest when DigestInterval
+	// is set.
+	digest changeDigest
+	// apiToken guards the query API and POST /resync when APITokenFile is
+	// set.
+	apiToken *apiToken
+
+	// Settings that can be changed at runtime through -reload-file.
+	dryRun         atomic.Bool
+	debounceWindow atomic.Int64 // time.Duration
+
+	// watchList holds the ConfigMap keys loaded from -watch-list, or nil to
+	// handle every ConfigMap.
+	watchList atomic.Pointer[map[string]bool]
+
+	// cachesSynced is flipped once the informer caches have synced.
+	cachesSynced atomic.Bool
+	// podIndexesReady is flipped after the first full sync once the Pod
+	// indexes the query API answers from are confirmed in place.
+	podIndexesReady atomic.Bool
+	// standby is set while this replica waits for the leader election
+	// Lease, with no informers running.
+	standby atomic.Bool
+
+	// restarted records, per ConfigMap key, the workloads already restarted
+	// for the update currently being retried so a retry never restarts the
+	// same workload twice. A newer update clears it.
+	restarted   map[string]map[workloadRef]bool
+	restartedMu sync.Mutex
+
+	// notified holds, per ConfigMap key, the correlation ID of the reconcile
+	// that sent the ReferencedPodsFound event and the webhook, so retries of
+	// the same update do not send them again. A newer update clears it.
+	notified   map[string]string
+	notifiedMu sync.Mutex
+
+	// deletedUIDs holds, per key, the UID of each referenced ConfigMap
+	// deleted since startup, so its recreation is recognised as a replace.
+	// replaced holds the keys of replaced ConfigMaps until their reconcile
+	// succeeds.
+	deletedUIDs map[string]types.UID
+	replaced    map[string]bool
+	replacedMu  sync.Mutex
+
+	// resyncOnly holds the keys queued by resyncAll with no update pending,
+	// whose reconcile only reports.
+	resyncOnly   map[string]bool
+	resyncOnlyMu sync.Mutex
+
+	// podLogLimiter samples Pod event log lines when PodLogSampleRate is
+	// set, and suppressedPodLogs counts the lines it dropped.
+	podLogLimiter     *rate.Limiter
+	suppressedPodLogs atomic.Int64
+
+	// shedding is set while handler tasks and resyncs are shed because the
+	// work queues are at MaxQueueDepth.
+	shedding atomic.Bool
+
+	// changedKeys accumulates, per ConfigMap key, the data keys changed by
+	// updates that have not been reconciled yet.
+	changedKeys   map[string]map[string]struct{}
+	changedKeysMu sync.Mutex
+
+	// reconcileIDs holds, per ConfigMap key, the correlation ID logged by
+	// the pending reconcile and the update that triggered it.
+	reconcileIDs   map[string]string
+	reconcileIDsMu sync.Mutex
+
+	// replicaSetOwners caches, per ReplicaSet namespace/name, the Deployment
+	// owning it. Entries are dropped when the ReplicaSet is deleted.
+	replicaSetOwners   map[string]workloadRef
+	replicaSetOwnersMu sync.Mutex
+
+	restartLimiters   map[string]*rate.Limiter
+	restartLimitersMu sync.Mutex
+
+	// recreateStarted tracks the recreate of each workload in progress.
+	recreateStarted   map[workloadRef]recreateState
+	recreateStartedMu sync.Mutex
+
+	// restartCooldowns records when each workload was last restarted.
+	restartCooldowns   map[workloadRef]time.Time
+	restartCooldownsMu sync.Mutex
+
+	circuits   map[string]*restartCircuit
+	circuitsMu sync.Mutex
+
+	// skippedConfigMaps holds the keys of ConfigMaps skipped by
+	// -referenced-only because no Pod referenced them.
+	skippedConfigMaps   map[string]bool
+	skippedConfigMapsMu sync.Mutex
+
+	watchErrorStates   map[string]*watchErrorState
+	watchErrorStatesMu sync.Mutex
+}
+
+// NewController connects to the API server described by cfg, waiting up to
+// opts.StartupTimeout for it to become reachable, and builds a Controller.
+func NewController(cfg *rest.Config, opts Options) (*Controller, error) {
+	clientset, err := connect(cfg, opts.StartupTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to Kubernetes API server: %w", err)
+	}
+	if !opts.ConfigMapOnly {
+		ctx, cancel := context.WithTimeout(context.Background(), opts.StartupTimeout)
+		defer cancel()
+		for _, ns := range watchedNamespaces(opts) {
+			if err := checkPodAccess(ctx, clientset, ns); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return newController(clientset, opts)
+}
+
+// newController builds a Controller around an existing clientset and sets up
+// its informers and indexers. Nothing is started until Run.
+func newController(clientset kubernetes.Interface, opts Options) (*Controller, error) {
+	if opts.ConfigMapSelector == nil {
+		opts.ConfigMapSelector = labels.Everything()
+	}
+	if opts.PodFieldSelector == nil {
+		opts.PodFieldSelector = fields.Everything()
+	}
+
+	c := &Controller{
+		opts:               opts,
+		clientset:          clientset,
+		ignoredNamespaces:  make(map[string]bool, len(opts.IgnoredNamespaces)),
+		configMapsFiltered: !opts.ConfigMapSelector.Empty(),
+		queue:              workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]()),
+		tasks:              workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[task]()),
+		restarted:          make(map[string]map[workloadRef]bool),
+		notified:           make(map[string]string),
+		deletedUIDs:        make(map[string]types.UID),
+		replaced:           make(map[string]bool),
+		resyncOnly:         make(map[string]bool),
+		changedKeys:        make(map[string]map[string]struct{}),
+		reconcileIDs:       make(map[string]string),
+		replicaSetOwners:   make(map[string]workloadRef),
+		restartLimiters:    make(map[string]*rate.Limiter),
+		restartCooldowns:   make(map[workloadRef]time.Time),
+		recreateStarted:    make(map[workloadRef]recreateState),
+		circuits:           make(map[string]*restartCircuit),
+		skippedConfigMaps:  make(map[string]bool),
+		watchErrorStates:   make(map[string]*watchErrorState),
+	}
+	if opts.PodLogSampleRate > 0 {
+		c.podLogLimiter = rate.NewLimiter(rate.Limit(opts.PodLogSampleRate), opts.PodLogSampleRate)
+	}
+	c.digest.configMaps = make(map[string]*digestConfigMapChanges)
+	if opts.WebhookURL != "" || opts.DigestWebhookURL != "" {
+		c.webhooks = newWebhookNotifier(&http.Client{Timeout: opts.WebhookTimeout}, opts.WebhookQueueSize)
+	}
+	if len(opts.MirrorConfigMaps) > 0 {
+		c.mirrors = make(map[string][]objectRef)
+		for _, rule := range opts.MirrorConfigMaps {
+			key := rule.Source.Namespace + "/" + rule.Source.Name
+			c.mirrors[key] = append(c.mirrors[key], rule.Target)
+		}
+		c.mirrorQueue = workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[string]())
+	}
+	c.dryRun.Store(opts.DryRun)
+	c.debounceWindow.Store(int64(opts.DebounceWindow))
+	for _, ns := range opts.IgnoredNamespaces {
+		c.ignoredNamespaces[ns] = true
+	}
+	if len(opts.RestartNamespaces) > 0 {
+		c.restartNamespaces = make(map[string]bool, len(opts.RestartNamespaces))
+		for _, ns := range opts.RestartNamespaces {
+			c.restartNamespaces[ns] = true
+		}
+		if opts.EnableRestart {
+			slog.Info("Restarts limited to namespaces", "namespaces", opts.RestartNamespaces)
+		}
+	}
+	if len(opts.ContainerNames) > 0 {
+		c.containerNames = make(map[string]bool, len(opts.ContainerNames))
+		for _, name := range opts.ContainerNames {
+			c.containerNames[name] = true
+		}
+		slog.Info("Env references limited to containers", "containers", opts.ContainerNames)
+	}
+	if len(opts.AnnotationRefKeys) > 0 {
+		slog.Info("Reading ConfigMap references from Pod annotations", "annotations", opts.AnnotationRefKeys)
+	}
+	if len(opts.ReferenceAnnotations) > 0 {
+		slog.Info("Reading ConfigMap references from workload annotations", "annotations", opts.ReferenceAnnotations)
+	}
+	if len(opts.IgnoreOwnerKinds) > 0 {
+		c.ignoredOwnerKinds = make(map[string]bool, len(opts.IgnoreOwnerKinds))
+		for _, kind := range opts.IgnoreOwnerKinds {
+			c.ignoredOwnerKinds[kind] = true
+		}
+	}
+	if opts.WatchListFile != "" {
+		if err := c.reloadWatchList(); err != nil {
+			return nil, fmt.Errorf("loading -watch-list: %w", err)
+		}
+	}
+	if opts.TLSCertFile != "" {
+		certs, err := newCertReloader(opts.TLSCertFile, opts.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.certs = certs
+	}
+	if opts.APITokenFile != "" {
+		token, err := newAPIToken(opts.APITokenFile)
+		if err != nil {
+			return nil, err
+		}
+		c.apiToken = token
+	}
+
+	// Set up event recorder so ConfigMap activity shows up in kubectl describe
+	c.eventBroadcaster = record.NewBroadcaster()
+	c.eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	c.recorder = c.eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "configmap-watcher"})
+
+	if !opts.WatchData && !opts.WatchBinaryData {
+		slog.Warn("Both -watch-data and -watch-binary-data are disabled, so every ConfigMap data update is treated as a no-op")
+	}
+	if opts.ResyncPeriod == 0 {
+		slog.Info("Periodic resync disabled")
+	} else {
+		slog.Info("Resync period configured", "resyncPeriod", opts.ResyncPeriod)
+	}
+	switch {
+	case len(opts.Namespaces) > 0:
+		slog.Info("Watching namespaces", "namespaces", opts.Namespaces)
+	case opts.Namespace != "":
+		slog.Info("Watching single namespace", "namespace", opts.Namespace)
+	default:
+		slog.Info("Watching all namespaces")
+	}
+	slog.Info("Ignoring namespaces", "namespaces", opts.IgnoredNamespaces)
+	if c.configMapsFiltered {
+		slog.Info("Filtering ConfigMaps by label selector", "selector", opts.ConfigMapSelector.String())
+	}
+	if !opts.PodFieldSelector.Empty() {
+		slog.Info("Filtering Pods by field selector", "selector", opts.PodFieldSelector.String())
+	}
+
+	// Create shared informer factories with resync period, one set per
+	// watched namespace
+	for _, ns := range watchedNamespaces(opts) {
+		c.factories = append(c.factories, c.newNamespaceFactories(ns))
+	}
+
+	// Get informers, combined across namespaces
+	c.configMapInformer = combineInformers(c.factories, func(f namespaceFactories) cache.SharedIndexInformer {
+		return f.configMaps.Core().V1().ConfigMaps().Informer()
+	})
+	c.podInformer = combineInformers(c.factories, func(f namespaceFactories) cache.SharedIndexInformer {
+		return f.pods.Core().V1().Pods().Informer()
+	})
+
+	// Add indexer on Pods to get configMap ref
+	err := c.podInformer.AddIndexers(cache.Indexers{
+		"configMapRef":    c.configMapRefIndexFunc,
+		"configMapKeyRef": c.configMapKeyRefIndexFunc,
+		"nodeName":        nodeNameIndexFunc,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("adding pod indexer: %w", err)
+	}
+
+	if opts.WatchSecrets {
+		c.secretInformer = combineInformers(c.factories, func(f namespaceFactories) cache.SharedIndexInformer {
+			return f.informers.Core().V1().Secrets().Informer()
+		})
+
+		// Add indexer on Pods to get secret ref
+		err = c.podInformer.AddIndexers(cache.Indexers{"secretRef": secretRefIndexFunc})
+		if err != nil {
+			return nil, fmt.Errorf("adding pod indexer: %w", err)
+		}
+	}
+
+	if opts.WatchBatch {
+		c.jobInformer = combineInformers(c.factories, func(f namespaceFactories) cache.SharedIndexInformer {
+			return f.informers.Batch().V1().Jobs().Informer()
+		})
+		c.cronJobInformer = combineInformers(c.factories, func(f namespaceFactories) cache.SharedIndexInformer {
+			return f.informers.Batch().V1().CronJobs().Informer()
+		})
+
+		// Index pod templates so Jobs and CronJobs are found between runs
+		for _, informer := range []cache.SharedIndexInformer{c.jobInformer, c.cronJobInformer} {
+			err = informer.AddIndexers(cache.Indexers{"configMapRefWorkload": c.configMapRefWorkload})
+			if err != nil {
+				return nil, fmt.Errorf("adding batch indexer: %w", err)
+			}
+		}
+	}
+
+	if opts.EnableRestart || opts.readsWorkloadAnnotations() {
+		c.deploymentInformer = combineInformers(c.factories, func(f namespaceFactories) cache.SharedIndexInformer {
+			return f.informers.Apps().V1().Deployments().Informer()
+		})
+		c.replicaSetInformer = combineInformers(c.factories, func(f namespaceFactories) cache.SharedIndexInformer {
+			return f.informers.Apps().V1().ReplicaSets().Informer()
+		})
+	}
+
+	if opts.readsWorkloadAnnotations() {
+		c.statefulSetInformer = combineInformers(c.factories, func(f namespaceFactories) cache.SharedIndexInformer {
+			return f.informers.Apps().V1().StatefulSets().Informer()
+		})
+		c.daemonSetInformer = combineInformers(c.factories, func(f namespaceFactories) cache.SharedIndexInformer {
+			return f.informers.Apps().V1().DaemonSets().Informer()
+		})
+
+		// Index workloads by the ConfigMaps their Reloader annotations name,
+		// and Pods and ReplicaSets by controller to find the Pods of each
+		for _, informer := range c.reloaderWorkloadInformers() {
+			err = informer.AddIndexers(cache.Indexers{"reloaderConfigMapRef": c.reloaderConfigMapRefIndexFunc})
+			if err != nil {
+				return nil, fmt.Errorf("adding workload indexer: %w", err)
+			}
+		}
+		for _, informer := range []cache.SharedIndexInformer{c.podInformer, c.replicaSetInformer} {
+			err = informer.AddIndexers(cache.Indexers{"controller": controllerIndexFunc})
+			if err != nil {
+				return nil, fmt.Errorf("adding controller indexer: %w", err)
+			}
+		}
+	}
+
+	err = prometheus.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "pods_referencing_configmaps",
+		Help: "Number of cached Pods referencing at least one ConfigMap.",
+	}, c.countReferencingPods))
+	if err != nil {
+		return nil, fmt.Errorf("registering metrics: %w", err)
+	}
+	err = prometheus.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "workqueue_depth",
+		Help: "Number of ConfigMaps waiting in the work queue plus handler tasks waiting in the task queue.",
+	}, func() float64 { return float64(c.queuedWork()) }))
+	if err != nil {
+		return nil, fmt.Errorf("registering metrics: %w", err)
+	}
+
+	return c, nil
+}
+
+// Report waits for the ConfigMap and Pod caches to sync and prints the
+// ConfigMap to Pod mapping without registering event handlers.
+func (c *Controller) Report(ctx context.Context, w io.Writer) error {
+	stopInformers := c.startInformers(ctx)
+	defer stopInformers()
+	if err := c.waitForCacheSync(ctx); err != nil {
+		return err
+	}
+	return c.printReport(w)
+}
+
+// Run serves HTTP, registers the event handlers and runs the informers and
+// workers, behind leader election when enabled, until ctx is done.
+func (c *Controller) Run(ctx context.Context) error {
+	defer c.eventBroadcaster.Shutdown()
+	defer c.queue.ShutDown()
+
+	// Surface watch failures such as missing RBAC
+	for resource, informer := range c.watchedInformers() {
+		if err := c.setWatchErrorHandler(resource, informer); err != nil {
+			return fmt.Errorf("setting watch error handler for %s: %w", resource, err)
+		}
+	}
+
+	// Register event handlers
+	c.configMapInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.onConfigMapAdd,
+		UpdateFunc: c.onConfigMapUpdate,
+		DeleteFunc: c.onConfigMapDelete,
+	})
+	c.podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.onPodAdd,
+		UpdateFunc: c.onPodUpdate,
+		DeleteFunc: c.onPodDelete,
+	})
+	if c.secretInformer != nil {
+		c.secretInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.onSecretAdd,
+			UpdateFunc: c.onSecretUpdate,
+			DeleteFunc: c.onSecretDelete,
+		})
+	}
+	if c.replicaSetInformer != nil {
+		c.replicaSetInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			DeleteFunc: c.onReplicaSetDelete,
+		})
+	}
+
+	// Reload runtime-tunable settings on SIGHUP
+	go c.watchReloadSignal(ctx.Done())
+	go c.watchResyncSignal(ctx.Done())
+	if c.podLogLimiter != nil {
+		go c.summarizeSuppressedPodLogs(ctx.Done())
+	}
+	if c.opts.WatchListFile != "" {
+		go c.watchWatchListFile(ctx.Done())
+	}
+
+	// Start metrics and health server
+	if err := c.serveHTTP(ctx.Done()); err != nil {
+		return err
+	}
+	if c.opts.GRPCAddr != "" {
+		if err := c.serveGRPC(ctx.Done()); err != nil {
+			return err
+		}
+	}
+
+	if !c.opts.EnableLeaderElection {
+		return c.run(ctx)
+	}
+
+	var runErr error
+	err := c.runWithLeaderElection(ctx, func(ctx context.Context) {
+		runErr = c.run(ctx)
+	})
+	return errors.Join(err, runErr)
+}
+
+// run starts the informers and workers and blocks until ctx is done and
+// every informer goroutine has exited.
+func (c *Controller) run(ctx context.Context) error {
+	// Start informers. Deferred first, the stop runs last, once the workers
+	// no longer need the caches, and also when the caches fail to sync
+	slog.Info("Starting informers")
+	stopInformers := c.startInformers(ctx)
+	defer stopInformers()
+
+	// Wait for all caches to sync
+	if err := c.waitForCacheSync(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	c.cachesSynced.Store(true)
+	if err := c.checkPodIndexes(); err != nil {
+		return err
+	}
+	c.podIndexesReady.Store(true)
+	c.checkAllRequiredConfigMaps()
+	if c.opts.SnapshotDir != "" {
+		go c.writeSnapshots(ctx.Done())
+	}
+	go c.sampleInformerMetrics(ctx.Done())
+	var digestsDone chan struct{}
+	if c.opts.DigestInterval > 0 {
+		digestsDone = make(chan struct{})
+		go func() {
+			defer close(digestsDone)
+			c.emitDigests(ctx.Done())
+		}()
+	}
+
+	if c.mirrorQueue != nil {
+		defer c.mirrorQueue.ShutDown()
+		go c.runMirrorWorker(ctx)
+	}
+	defer c.tasks.ShutDown()
+	go c.runTaskWorker(ctx)
+
+	// Notifications keep flowing while the queue drains. The notifier stops
+	// once the workers and the final digest have queued their last ones,
+	// and gets up to -shutdown-timeout more to send them
+	if c.webhooks != nil {
+		webhooksStop := make(chan struct{})
+		webhooksDone := make(chan struct{})
+		go func() {
+			defer close(webhooksDone)
+			c.webhooks.run(webhooksStop, c.opts.ShutdownTimeout)
+		}()
+		defer func() {
+			if digestsDone != nil {
+				<-digestsDone
+			}
+			close(webhooksStop)
+			<-webhooksDone
+		}()
+	}
+
+	// Start workers. Their context outlives ctx so queued work can drain
+	// on shutdown, and is cancelled once -shutdown-timeout elapses.
+	workCtx, cancelWork := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelWork()
+
+	var wg sync.WaitGroup
+	for range c.opts.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.runWorker(workCtx)
+		}()
+	}
+
+	slog.Info("Informers running", "workers", c.opts.Workers)
+	<-ctx.Done()
+
+	// Stop accepting new work and let the workers finish what is queued
+	if !c.drainQueue(&wg, c.opts.ShutdownTimeout, cancelWork) {
+		return fmt.Errorf("%w after %s with %d items unprocessed", errDrainTimeout, c.opts.ShutdownTimeout, c.queue.Len())
+	}
+	return nil
+}
+
+// startInformers starts the informers until ctx is done or the returned
+// function is called. That function stops them and waits for every
+// goroutine they started to exit, so none outlive Run or Report. The caches
+// keep their contents.
+func (c *Controller) startInformers(ctx context.Context) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	for _, f := range c.factories {
+		f.informers.Start(ctx.Done())
+		f.configMaps.Start(ctx.Done())
+		// Without Pods the pod informer is never started and its indexer
+		// stays empty
+		if !c.opts.ConfigMapOnly {
+			f.pods.Start(ctx.Done())
+		}
+	}
+
+	return func() {
+		cancel()
+		// Shutdown waits for the informers' goroutines and is a no-op for
+		// factories that were never started or are shared
+		for _, f := range c.factories {
+			f.informers.Shutdown()
+			f.configMaps.Shutdown()
+			f.pods.Shutdown()
+		}
+		slog.Info("Informers stopped")
+	}
+}
+
+// waitForCacheSync waits up to CacheSyncTimeout for every watched informer
+// to sync. It returns errCacheSyncFailed once the timeout expires, and the
+// error of ctx when ctx is done first.
+func (c *Controller) waitForCacheSync(ctx context.Context) error {
+	var synced []cache.InformerSynced
+	for _, informer := range c.watchedInformers() {
+		synced = append(synced, informer.HasSynced)
+	}
+	syncCtx, cancel := context.WithTimeout(ctx, c.opts.CacheSyncTimeout)
+	defer cancel()
+	if cache.WaitForCacheSync(syncCtx.Done(), synced...) {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w within -cache-sync-timeout %s", errCacheSyncFailed, c.opts.CacheSyncTimeout)
+}
+
+// podIndexes lists the Pod indexes the query API and readiness depend on.
+var podIndexes = []string{"configMapRef", "configMapKeyRef", "nodeName"}
+
+// checkPodIndexes confirms that every index in podIndexes is registered on
+// the Pod indexer and can be queried. Indexes added before the informer
+// starts are built as the cache fills, so after a full sync they cover
+// every cached Pod.
+func (c *Controller) checkPodIndexes() error {
+	indexer := c.podInformer.GetIndexer()
+	indexers := indexer.GetIndexers()
+	for _, name := range podIndexes {
+		if _, ok := indexers[name]; !ok {
+			return fmt.Errorf("pod index %s is not registered", name)
+		}
+		if _, err := indexer.IndexKeys(name, ""); err != nil {
+			return fmt.Errorf("querying pod index %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// apiReady reports whether the caches have synced and the Pod indexes are
+// in place, so queries no longer return partial results.
+func (c *Controller) apiReady() bool {
+	return c.cachesSynced.Load() && c.podIndexesReady.Load()
+}
+
+// watchedInformers returns every informer in use, by resource name.
+func (c *Controller) watchedInformers() map[string]cache.SharedIndexInformer {
+	informers := map[string]cache.SharedIndexInformer{
+		"configmaps": c.configMapInformer,
+	}
+	if !c.opts.ConfigMapOnly {
+		informers["pods"] = c.podInformer
+	}
+	if c.secretInformer != nil {
+		informers["secrets"] = c.secretInformer
+	}
+	if c.jobInformer != nil {
+		informers["jobs"] = c.jobInformer
+		informers["cronjobs"] = c.cronJobInformer
+	}
+	if c.deploymentInformer != nil {
+		informers["deployments"] = c.deploymentInformer
+		informers["replicasets"] = c.replicaSetInformer
+	}
+	if c.statefulSetInformer != nil {
+		informers["statefulsets"] = c.statefulSetInformer
+		informers["daemonsets"] = c.daemonSetInformer
+	}
+	return informers
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/utils/ptr"
+)
+
+// newTestController returns a Controller over a fake clientset seeded with
+// objs. Its queues and event broadcaster are shut down when the test ends.
+func newTestController(t *testing.T, opts Options, objs ...runtime.Object) (*Controller, *fake.Clientset) {
+	t.Helper()
+
+	// newController registers gauges, which a registry accepts only once
+	registerer := prometheus.DefaultRegisterer
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+	t.Cleanup(func() { prometheus.DefaultRegisterer = registerer })
+
+	if opts.CacheSyncTimeout == 0 {
+		opts.CacheSyncTimeout = 10 * time.Second
+	}
+	clientset := fake.NewClientset(objs...)
+	c, err := newController(clientset, opts)
+	if err != nil {
+		t.Fatalf("newController: %v", err)
+	}
+	t.Cleanup(func() {
+		c.queue.ShutDown()
+		c.tasks.ShutDown()
+		if c.mirrorQueue != nil {
+			c.mirrorQueue.ShutDown()
+		}
+		c.eventBroadcaster.Shutdown()
+	})
+	return c, clientset
+}
+
+// startTestInformers starts the informers of c and waits for their caches to
+// sync. They are stopped when the test ends.
+func startTestInformers(t *testing.T, c *Controller) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := c.startInformers(ctx)
+	t.Cleanup(func() {
+		cancel()
+		stop()
+	})
+	if err := c.waitForCacheSync(ctx); err != nil {
+		t.Fatalf("waiting for cache sync: %v", err)
+	}
+}
+
+// testPod returns a running Pod in the default namespace with spec.
+func testPod(name string, spec v1.PodSpec) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec:       spec,
+		Status:     v1.PodStatus{Phase: v1.PodRunning},
+	}
+}
+
+// testConfigMap returns a ConfigMap in the default namespace with data.
+func testConfigMap(name string, data map[string]string) *v1.ConfigMap {
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID("uid-" + name), ResourceVersion: "1"},
+		Data:       data,
+	}
+}
+
+// controlledBy sets the controller owner reference of obj.
+func controlledBy(obj metav1.Object, kind, name string) {
+	obj.SetOwnerReferences([]metav1.OwnerReference{{
+		APIVersion: "apps/v1",
+		Kind:       kind,
+		Name:       name,
+		UID:        types.UID("uid-" + name),
+		Controller: ptr.To(true),
+	}})
+}
+
+// volumeSpec returns a Pod spec mounting the named ConfigMap as a volume.
+func volumeSpec(name string) v1.PodSpec {
+	return v1.PodSpec{
+		Containers: []v1.Container{{Name: "app"}},
+		Volumes: []v1.Volume{{
+			Name: "config",
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: name}},
+			},
+		}},
+	}
+}
+
+func TestRunReturnsOnCancel(t *testing.T) {
+	c, _ := newTestController(t, Options{
+		MetricsAddr: "127.0.0.1:0", Workers: 2, ShutdownTimeout: time.Second, InformerMetricsInterval: time.Minute,
+	},
+		testConfigMap("app-config", nil), testPod("web", volumeSpec("app-config")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Run(ctx) }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !c.cachesSynced.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("caches did not sync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Errorf("Run() = %v, want nil", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestRunSendsFinalDigest(t *testing.T) {
+	var delivered atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered.Add(1)
+	}))
+	defer srv.Close()
+
+	c, _ := newTestController(t, Options{
+		MetricsAddr: "127.0.0.1:0", Workers: 2, ShutdownTimeout: 10 * time.Second, InformerMetricsInterval: time.Minute,
+		DigestInterval: time.Hour, DigestWebhookURL: srv.URL, WebhookTimeout: time.Second, WebhookQueueSize: 10,
+	},
+		testConfigMap("app-config", nil), testPod("web", volumeSpec("app-config")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() { errCh <- c.Run(ctx) }()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !c.cachesSynced.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("caches did not sync")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// The partial window emitted on shutdown is delivered before Run returns
+	c.recordDigestChange("default/app-config", []string{"level"})
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Errorf("Run() = %v, want nil", err)
+		}
+	case <-time.After(20 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+	if n := delivered.Load(); n != 1 {
+		t.Errorf("digests delivered = %d, want 1", n)
+	}
+}
+
+func TestReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		cancel  bool
+		want    string
+		wantErr error
+	}{
+		{name: "prints mapping", want: "default/app-config (1 pods)\n  - default/web\n"},
+		{name: "cancelled before sync", cancel: true, wantErr: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestController(t, Options{}, testConfigMap("app-config", nil), testPod("web", volumeSpec("app-config")))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			var out strings.Builder
+			err := c.Report(ctx, &out)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Report() = %v, want %v", err, tt.wantErr)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("Report() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
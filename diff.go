@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// keyChange is a modified key and the change in its value's byte length.
+// Values are never recorded since they may be sensitive.
+type keyChange struct {
+	Key   string `json:"key"`
+	Delta int    `json:"delta"`
+}
+
+// configMapDiff lists the keys that changed between two versions of a
+// ConfigMap across Data and BinaryData.
+type configMapDiff struct {
+	Added    []string    `json:"added,omitempty"`
+	Removed  []string    `json:"removed,omitempty"`
+	Modified []keyChange `json:"modified,omitempty"`
+}
+
+// diffConfigMaps compares the Data of two ConfigMap versions when data is
+// set and their BinaryData when binaryData is set.
+func diffConfigMaps(oldCM, newCM *v1.ConfigMap, data, binaryData bool) configMapDiff {
+	var d configMapDiff
+	if data {
+		diffKeys(&d, stringValues(oldCM.Data), stringValues(newCM.Data))
+	}
+	if binaryData {
+		diffKeys(&d, oldCM.BinaryData, newCM.BinaryData)
+	}
+
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Slice(d.Modified, func(i, j int) bool { return d.Modified[i].Key < d.Modified[j].Key })
+	return d
+}
+
+// ChangedKeys returns every added, removed or modified key, sorted.
+func (d configMapDiff) ChangedKeys() []string {
+	keys := make([]string, 0, len(d.Added)+len(d.Removed)+len(d.Modified))
+	keys = append(keys, d.Added...)
+	keys = append(keys, d.Removed...)
+	for _, c := range d.Modified {
+		keys = append(keys, c.Key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func diffKeys(d *configMapDiff, oldData, newData map[string][]byte) {
+	for k, newVal := range newData {
+		oldVal, ok := oldData[k]
+		if !ok {
+			d.Added = append(d.Added, k)
+			continue
+		}
+		if string(oldVal) != string(newVal) {
+			d.Modified = append(d.Modified, keyChange{Key: k, Delta: len(newVal) - len(oldVal)})
+		}
+	}
+	for k := range oldData {
+		if _, ok := newData[k]; !ok {
+			d.Removed = append(d.Removed, k)
+		}
+	}
+}
+
+func stringValues(data map[string]string) map[string][]byte {
+	out := make(map[string][]byte, len(data))
+	for k, v := range data {
+		out[k] = []byte(v)
+	}
+	return out
+}
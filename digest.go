@@ -0,0 +1,215 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// changeDigest accumulates the ConfigMap changes of one DigestInterval.
+type changeDigest struct {
+	mu    sync.Mutex
+	start time.Time
+	// configMaps is keyed by namespace/name.
+	configMaps map[string]*digestConfigMapChanges
+}
+
+type digestConfigMapChanges struct {
+	updates     int
+	changedKeys map[string]struct{}
+	workloads   map[workloadRef]struct{}
+}
+
+// digestPayload is the summary of one window, logged and sent to
+// DigestWebhookURL.
+type digestPayload struct {
+	From       time.Time         `json:"from"`
+	To         time.Time         `json:"to"`
+	Workloads  int               `json:"workloads"`
+	Namespaces []string          `json:"namespaces"`
+	ConfigMaps []digestConfigMap `json:"configmaps"`
+}
+
+type digestConfigMap struct {
+	ConfigMap   objectRef     `json:"configmap"`
+	Updates     int           `json:"updates"`
+	ChangedKeys []string      `json:"changedKeys"`
+	Workloads   []workloadRef `json:"workloads"`
+}
+
+// recordDigestChange adds an update of the ConfigMap stored under key to the
+// current digest window, with the changed data keys when known and the
+// workloads owning the Pods that consume them.
+func (c *Controller) recordDigestChange(key string, changedKeys []string) {
+	workloads := c.digestWorkloads(key, changedKeys)
+
+	c.digest.mu.Lock()
+	defer c.digest.mu.Unlock()
+	entry := c.digest.configMaps[key]
+	if entry == nil {
+		entry = &digestConfigMapChanges{changedKeys: make(map[string]struct{}), workloads: make(map[workloadRef]struct{})}
+		c.digest.configMaps[key] = entry
+	}
+	entry.updates++
+	for _, k := range changedKeys {
+		entry.changedKeys[k] = struct{}{}
+	}
+	for _, w := range workloads {
+		entry.workloads[w] = struct{}{}
+	}
+}
+
+// digestWorkloads returns the workloads owning the Pods that consume
+// changedKeys of the ConfigMap stored under key, or any of it when no keys
+// are known, plus the Jobs and CronJobs referencing it. Only caches are
+// consulted, so a Pod whose Deployment is not known yet counts as its
+// ReplicaSet and a Pod without a controller as itself.
+func (c *Controller) digestWorkloads(key string, changedKeys []string) []workloadRef {
+	var workloads []workloadRef
+	if !c.opts.ConfigMapOnly {
+		var pods []*v1.Pod
+		if len(changedKeys) > 0 {
+			pods, _ = c.podsForConfigMapKeys(key, changedKeys)
+		} else {
+			objs, _ := c.podsReferencingConfigMap(key)
+			for _, obj := range objs {
+				if pod, ok := obj.(*v1.Pod); ok {
+					pods = append(pods, pod)
+				}
+			}
+		}
+		for _, pod := range pods {
+			workloads = append(workloads, c.cachedWorkload(pod))
+		}
+	}
+	if c.jobInformer != nil {
+		batch, _ := c.batchWorkloadsForConfigMap(key)
+		workloads = append(workloads, batch...)
+	}
+	return workloads
+}
+
+// cachedWorkload returns the controller owning pod, resolving ReplicaSets to
+// their Deployment from the caches only.
+func (c *Controller) cachedWorkload(pod *v1.Pod) workloadRef {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return workloadRef{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name}
+	}
+	ref := workloadRef{Kind: owner.Kind, Namespace: pod.Namespace, Name: owner.Name}
+	if owner.Kind != "ReplicaSet" {
+		return ref
+	}
+
+	c.replicaSetOwnersMu.Lock()
+	deployment, cached := c.replicaSetOwners[pod.Namespace+"/"+owner.Name]
+	c.replicaSetOwnersMu.Unlock()
+	if cached {
+		return deployment
+	}
+	if c.replicaSetInformer != nil {
+		obj, exists, _ := c.replicaSetInformer.GetIndexer().GetByKey(pod.Namespace + "/" + owner.Name)
+		if rs, ok := obj.(*appsv1.ReplicaSet); exists && ok {
+			if rsOwner := metav1.GetControllerOf(rs); rsOwner != nil && rsOwner.Kind == "Deployment" {
+				return workloadRef{Kind: "Deployment", Namespace: pod.Namespace, Name: rsOwner.Name}
+			}
+		}
+	}
+	return ref
+}
+
+// takeDigest returns the summary of the window ending at now and starts a
+// new one. The summary lists no ConfigMaps when nothing changed.
+func (c *Controller) takeDigest(now time.Time) digestPayload {
+	c.digest.mu.Lock()
+	from, configMaps := c.digest.start, c.digest.configMaps
+	c.digest.start = now
+	c.digest.configMaps = make(map[string]*digestConfigMapChanges)
+	c.digest.mu.Unlock()
+
+	payload := digestPayload{From: from.UTC(), To: now.UTC(), Namespaces: []string{}, ConfigMaps: []digestConfigMap{}}
+	workloads := make(map[workloadRef]struct{})
+	namespaces := make(map[string]struct{})
+	for key, entry := range configMaps {
+		ns, name, _ := strings.Cut(key, "/")
+		namespaces[ns] = struct{}{}
+		cm := digestConfigMap{
+			ConfigMap:   objectRef{Namespace: ns, Name: name},
+			Updates:     entry.updates,
+			ChangedKeys: make([]string, 0, len(entry.changedKeys)),
+			Workloads:   make([]workloadRef, 0, len(entry.workloads)),
+		}
+		for k := range entry.changedKeys {
+			cm.ChangedKeys = append(cm.ChangedKeys, k)
+		}
+		sort.Strings(cm.ChangedKeys)
+		for w := range entry.workloads {
+			cm.Workloads = append(cm.Workloads, w)
+			workloads[w] = struct{}{}
+			namespaces[w.Namespace] = struct{}{}
+		}
+		sort.Slice(cm.Workloads, func(i, j int) bool { return cm.Workloads[i].String() < cm.Workloads[j].String() })
+		payload.ConfigMaps = append(payload.ConfigMaps, cm)
+	}
+	sort.Slice(payload.ConfigMaps, func(i, j int) bool {
+		a, b := payload.ConfigMaps[i].ConfigMap, payload.ConfigMaps[j].ConfigMap
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	for ns := range namespaces {
+		payload.Namespaces = append(payload.Namespaces, ns)
+	}
+	sort.Strings(payload.Namespaces)
+	payload.Workloads = len(workloads)
+	return payload
+}
+
+// emitDigests logs, and sends to DigestWebhookURL, a summary of the
+// ConfigMap changes of every DigestInterval until stopCh is closed, then
+// emits the partial window. Windows without changes are skipped.
+func (c *Controller) emitDigests(stopCh <-chan struct{}) {
+	c.digest.mu.Lock()
+	c.digest.start = time.Now()
+	c.digest.mu.Unlock()
+
+	ticker := time.NewTicker(c.opts.DigestInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			c.emitDigest(c.takeDigest(time.Now()))
+			return
+		case now := <-ticker.C:
+			c.emitDigest(c.takeDigest(now))
+		}
+	}
+}
+
+func (c *Controller) emitDigest(payload digestPayload) {
+	if len(payload.ConfigMaps) == 0 {
+		slog.Debug("No ConfigMap changes in digest window", "from", payload.From, "to", payload.To)
+		return
+	}
+	names := make([]string, 0, len(payload.ConfigMaps))
+	for _, cm := range payload.ConfigMaps {
+		names = append(names, cm.ConfigMap.Namespace+"/"+cm.ConfigMap.Name)
+	}
+	slog.Info("ConfigMap change digest", "window", payload.To.Sub(payload.From).Round(time.Second),
+		"configMapsChanged", len(payload.ConfigMaps), "workloadsAffected", payload.Workloads, "namespaces", len(payload.Namespaces),
+		"configMaps", names)
+
+	if c.opts.DigestWebhookURL == "" {
+		return
+	}
+	if err := c.webhooks.notify(slog.Default(), c.opts.DigestWebhookURL, payload); err != nil {
+		slog.Error("Error queuing digest webhook", "url", c.opts.DigestWebhookURL, "err", err)
+	}
+}
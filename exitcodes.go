@@ -0,0 +1,42 @@
+package main
+
+import "errors"
+
+// Process exit codes, documented in the README so orchestration can tell a
+// clean shutdown from the failures below.
+const (
+	// exitOK is a clean shutdown.
+	exitOK = 0
+	// exitError is an invalid configuration or any other startup or runtime
+	// error.
+	exitError = 1
+	// exitCacheSyncFailed means the informer caches never synced.
+	exitCacheSyncFailed = 2
+	// exitLeadershipLost means the Lease was lost while still running.
+	exitLeadershipLost = 3
+	// exitDrainTimeout means the work queue did not drain within
+	// -shutdown-timeout.
+	exitDrainTimeout = 4
+)
+
+var (
+	errCacheSyncFailed = errors.New("failed to sync caches")
+	errLeadershipLost  = errors.New("leadership lost")
+	errDrainTimeout    = errors.New("timed out draining work queue")
+)
+
+// exitCode maps the error that stopped the controller to its exit code.
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errCacheSyncFailed):
+		return exitCacheSyncFailed
+	case errors.Is(err, errLeadershipLost):
+		return exitLeadershipLost
+	case errors.Is(err, errDrainTimeout):
+		return exitDrainTimeout
+	default:
+		return exitError
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchFiles calls reload whenever one of paths changes until stopCh is
+// closed; what names the files in log lines. The directories are watched
+// rather than the files so that editors replacing a file and ConfigMap or
+// Secret volumes swapping their ..data symlink are noticed too. A failed
+// reload is logged and should keep the previous contents.
+func watchFiles(stopCh <-chan struct{}, what string, paths []string, reload func() error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		slog.Error("Error watching file, changes need a restart", "file", what, "err", err)
+		return
+	}
+	defer watcher.Close()
+
+	names := map[string]bool{"..data": true}
+	var dirs []string
+	for _, path := range paths {
+		names[filepath.Base(path)] = true
+		dirs = append(dirs, filepath.Dir(path))
+	}
+	for _, dir := range dedupe(dirs) {
+		if err := watcher.Add(dir); err != nil {
+			slog.Error("Error watching file, changes need a restart", "file", what, "dir", dir, "err", err)
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !names[filepath.Base(event.Name)] {
+				continue
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) && !event.Has(fsnotify.Rename) {
+				continue
+			}
+			if err := reload(); err != nil {
+				slog.Error("Error reloading file, keeping current contents", "file", what, "err", err)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			slog.Warn("Error watching file", "file", what, "err", err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// hiddenFlags are left out of the -help output.
+var hiddenFlags = map[string]bool{}
+
+// usage prints the defaults of every flag except the hidden ones.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+
+	visible := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	visible.SetOutput(out)
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	visible.PrintDefaults()
+	fmt.Fprintf(out, "\nFlags not given on the command line are read from %s<FLAG> environment\nvariables, e.g. %s for -namespace.\n", envPrefix, envName("namespace"))
+}
+
+// stringListFlag is a repeatable flag accepting comma-separated values.
+// Values given on the command line replace the defaults.
+type stringListFlag struct {
+	values []string
+	set    bool
+}
+
+func newStringListFlag(defaults ...string) *stringListFlag {
+	return &stringListFlag{values: defaults}
+}
+
+func (f *stringListFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(f.values, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	if !f.set {
+		f.values = nil
+		f.set = true
+	}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			f.values = append(f.values, v)
+		}
+	}
+	return nil
+}
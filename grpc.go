@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+
+	referencegraphv1 "github.com/prasad89/kube-configmap-watcher/proto/referencegraph/v1"
+)
+
+// referenceGraphServer implements the ReferenceGraph gRPC service from the
+// same caches as the HTTP query API.
+type referenceGraphServer struct {
+	referencegraphv1.UnimplementedReferenceGraphServer
+	c *Controller
+}
+
+func (s *referenceGraphServer) ListPodsForConfigMap(ctx context.Context, req *referencegraphv1.ListPodsForConfigMapRequest) (*referencegraphv1.ListPodsForConfigMapResponse, error) {
+	key, err := s.key(req.GetNamespace(), req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	refs, exists, err := s.c.configMapPods(key)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "configmap %s not found", key)
+	}
+	return &referencegraphv1.ListPodsForConfigMapResponse{Pods: protoRefs(refs)}, nil
+}
+
+func (s *referenceGraphServer) ListConfigMapsForPod(ctx context.Context, req *referencegraphv1.ListConfigMapsForPodRequest) (*referencegraphv1.ListConfigMapsForPodResponse, error) {
+	key, err := s.key(req.GetNamespace(), req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	refs, exists, err := s.c.podConfigMaps(key)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "pod %s not found", key)
+	}
+	return &referencegraphv1.ListConfigMapsForPodResponse{ConfigMaps: protoRefs(refs)}, nil
+}
+
+// key validates a request and returns the store key of the object it names.
+// Like the HTTP API it answers UNAVAILABLE until the caches have synced.
+func (s *referenceGraphServer) key(namespace, name string) (string, error) {
+	if !s.c.apiReady() {
+		return "", status.Error(codes.Unavailable, "caches are still syncing")
+	}
+	if namespace == "" || name == "" {
+		return "", status.Error(codes.InvalidArgument, "namespace and name are required")
+	}
+	return namespace + "/" + name, nil
+}
+
+func protoRefs(refs []objectRef) []*referencegraphv1.ObjectRef {
+	out := make([]*referencegraphv1.ObjectRef, 0, len(refs))
+	for _, ref := range refs {
+		out = append(out, &referencegraphv1.ObjectRef{Namespace: ref.Namespace, Name: ref.Name})
+	}
+	return out
+}
+
+// serveGRPC starts the ReferenceGraph gRPC server on GRPCAddr and stops it
+// gracefully once stopCh is closed, cancelling calls still running after
+// 5 seconds. It shares the TLS certificate and API token of the HTTP server.
+func (c *Controller) serveGRPC(stopCh <-chan struct{}) error {
+	addr := c.opts.GRPCAddr
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening on -grpc-addr %s: %w", addr, err)
+	}
+
+	opts := []grpc.ServerOption{grpc.UnaryInterceptor(c.requireTokenUnary)}
+	if c.certs != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(c.tlsConfig())))
+	}
+	srv := grpc.NewServer(opts...)
+	referencegraphv1.RegisterReferenceGraphServer(srv, &referenceGraphServer{c: c})
+
+	go func() {
+		<-stopCh
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			srv.Stop()
+		}
+	}()
+
+	go func() {
+		slog.Info("Serving gRPC reference graph", "addr", addr, "tls", c.certs != nil)
+		if err := srv.Serve(lis); err != nil {
+			slog.Error("gRPC server failed", "err", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"reflect"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+)
+
+func (c *Controller) onConfigMapAdd(obj any) {
+	cm, ok := obj.(*v1.ConfigMap)
+	if !ok || cm == nil {
+		warnUnexpectedObject("ConfigMap", "add", obj)
+		return
+	}
+	if c.ignoredNamespaces[cm.Namespace] || !c.watchListAllows(cm.Namespace+"/"+cm.Name) {
+		return
+	}
+	configMapEvents.WithLabelValues("add").Inc()
+	if configMapIgnored(cm) {
+		slog.Debug("Ignoring annotated ConfigMap", "event", "add", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+		return
+	}
+	if ownerKind, ok := c.configMapOwnerIgnored(cm); ok {
+		slog.Debug("Ignoring owned ConfigMap", "event", "add", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name, "ownerKind", ownerKind)
+		return
+	}
+	if c.mirrors != nil {
+		c.queueMirror(cm, "add")
+	}
+	if !c.configMapReferenced(cm.Namespace + "/" + cm.Name) {
+		return
+	}
+	key := cm.Namespace + "/" + cm.Name
+	slog.Info("ConfigMap added", "event", "add", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+	// Immutable ConfigMaps can only be changed by deleting and recreating
+	// them, which their consumers see as a change like any update
+	if c.recordReplaced(key, cm.UID) {
+		slog.Info("ConfigMap replaced", "event", "replace", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name,
+			"immutable", ptr.Deref(cm.Immutable, false), "reconcileID", c.reconcileID(key))
+		if c.opts.DigestInterval > 0 {
+			c.recordDigestChange(key, nil)
+		}
+		c.resetRestarted(key)
+		c.queue.AddAfter(key, time.Duration(c.debounceWindow.Load()))
+	}
+	// ConfigMaps listed at startup were not just created, so Pods waiting
+	// for them are only looked for once caches have synced
+	if c.cachesSynced.Load() && !c.opts.ConfigMapOnly {
+		c.addTask(task{Kind: taskConfigMapCreated, Key: key}, "configmap", "add")
+	}
+}
+
+func (c *Controller) onConfigMapUpdate(oldObj, newObj any) {
+	oldCM, ok := oldObj.(*v1.ConfigMap)
+	if !ok || oldCM == nil {
+		warnUnexpectedObject("ConfigMap", "update", oldObj)
+		return
+	}
+	cm, ok := newObj.(*v1.ConfigMap)
+	if !ok || cm == nil {
+		warnUnexpectedObject("ConfigMap", "update", newObj)
+		return
+	}
+	if c.ignoredNamespaces[cm.Namespace] || !c.watchListAllows(cm.Namespace+"/"+cm.Name) {
+		return
+	}
+	configMapEvents.WithLabelValues("update").Inc()
+	if configMapIgnored(cm) {
+		slog.Debug("Ignoring annotated ConfigMap", "event", "update", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+		return
+	}
+	if ownerKind, ok := c.configMapOwnerIgnored(cm); ok {
+		slog.Debug("Ignoring owned ConfigMap", "event", "update", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name, "ownerKind", ownerKind)
+		return
+	}
+	if c.mirrors != nil {
+		c.queueMirror(cm, "update")
+	}
+	resync := isResync(oldCM, cm)
+	// Comparing huge ConfigMaps on every update is too costly, so any
+	// update that is not a resync counts as a change
+	oversized := (c.opts.WatchData || c.opts.WatchBinaryData) && (c.oversized(oldCM) || c.oversized(cm))
+
+	// Skip resyncs, metadata-only changes and changes to unwatched fields
+	if (oversized && resync) || (!oversized && configMapContentEqual(oldCM, cm, c.opts.WatchData, c.opts.WatchBinaryData)) {
+		if resync {
+			slog.Debug("ConfigMap resynced", "event", "resync", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+		}
+		return
+	}
+
+	key := cm.Namespace + "/" + cm.Name
+	if !c.configMapReferenced(key) {
+		return
+	}
+	// Oversized ConfigMaps are not diffed, so their changed keys are unknown
+	var changed []string
+	if oversized {
+		slog.Info("ConfigMap updated, not diffed since it exceeds -max-diff-size", "event", "update", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name,
+			"size", configMapSize(cm), "maxDiffSize", c.opts.MaxDiffSize, "reconcileID", c.reconcileID(key))
+	} else {
+		diff := diffConfigMaps(oldCM, cm, c.opts.WatchData, c.opts.WatchBinaryData)
+		slog.Info("ConfigMap updated", "event", "update", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name,
+			"added", diff.Added, "removed", diff.Removed, "modified", diff.Modified, "reconcileID", c.reconcileID(key))
+		changed = diff.ChangedKeys()
+		c.recordChangedKeys(key, changed)
+	}
+	if c.opts.DigestInterval > 0 {
+		c.recordDigestChange(key, changed)
+	}
+	// Workloads restarted for an earlier version are restarted again for
+	// this one, even while that version is still being retried
+	c.resetRestarted(key)
+
+	// Immutable ConfigMaps are replaced rather than updated, and kubelet
+	// stops refreshing them
+	if !ptr.Deref(oldCM.Immutable, false) && ptr.Deref(cm.Immutable, false) {
+		slog.Info("ConfigMap marked immutable, consumers will only see changes after it is replaced and their Pods restarted",
+			"kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+	}
+
+	// Pod lookup and side effects happen in the workers. Updates to the same
+	// ConfigMap within the debounce window collapse into one reconcile since
+	// the delaying queue keeps only the earliest pending entry per key.
+	c.queue.AddAfter(key, time.Duration(c.debounceWindow.Load()))
+}
+
+// isResync reports whether an update event was delivered by a periodic
+// resync rather than by a change on the API server, which always bumps the
+// ResourceVersion.
+func isResync(oldObj, newObj metav1.Object) bool {
+	return oldObj.GetResourceVersion() == newObj.GetResourceVersion()
+}
+
+// configMapContentEqual reports whether two versions of a ConfigMap have the
+// same immutability and, for each enabled field, the same data or binaryData.
+func configMapContentEqual(a, b *v1.ConfigMap, data, binaryData bool) bool {
+	if data && (len(a.Data) != 0 || len(b.Data) != 0) {
+		if !reflect.DeepEqual(a.Data, b.Data) {
+			return false
+		}
+	}
+	if binaryData && (len(a.BinaryData) != 0 || len(b.BinaryData) != 0) {
+		if !reflect.DeepEqual(a.BinaryData, b.BinaryData) {
+			return false
+		}
+	}
+	return reflect.DeepEqual(a.Immutable, b.Immutable)
+}
+
+func (c *Controller) onConfigMapDelete(obj any) {
+	var cm *v1.ConfigMap
+	switch obj := obj.(type) {
+	case *v1.ConfigMap:
+		cm = obj
+	case cache.DeletedFinalStateUnknown:
+		cm, _ = obj.Obj.(*v1.ConfigMap)
+	}
+	if cm == nil {
+		warnUnexpectedObject("ConfigMap", "delete", obj)
+		return
+	}
+	key := cm.Namespace + "/" + cm.Name
+	// Whichever path the delete takes, the ConfigMap is gone, and so is any
+	// earlier skip of it by -referenced-only
+	defer c.forgetSkippedConfigMap(key)
+	if c.ignoredNamespaces[cm.Namespace] || !c.watchListAllows(key) {
+		return
+	}
+	configMapEvents.WithLabelValues("delete").Inc()
+	if configMapIgnored(cm) {
+		slog.Debug("Ignoring annotated ConfigMap", "event", "delete", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+		return
+	}
+	if ownerKind, ok := c.configMapOwnerIgnored(cm); ok {
+		slog.Debug("Ignoring owned ConfigMap", "event", "delete", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name, "ownerKind", ownerKind)
+		return
+	}
+	if c.mirrors != nil {
+		c.queueMirror(cm, "delete")
+	}
+	if !c.configMapReferenced(key) {
+		return
+	}
+	slog.Info("ConfigMap deleted", "event", "delete", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+	c.recordDeleted(key, cm.UID)
+	c.addTask(task{Kind: taskConfigMapDeleted, Key: key}, "configmap", "delete")
+}
+
+func (c *Controller) onPodAdd(obj any) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || pod == nil {
+		warnUnexpectedObject("Pod", "add", obj)
+		return
+	}
+	if c.ignoredNamespaces[pod.Namespace] {
+		return
+	}
+	podEvents.WithLabelValues("add").Inc()
+	c.logPodEvent("Pod added", "add", pod)
+	c.checkRequiredConfigMaps(pod)
+	c.reevaluateSkippedConfigMaps(pod)
+}
+
+func (c *Controller) onPodUpdate(oldObj, newObj any) {
+	oldPod, ok := oldObj.(*v1.Pod)
+	if !ok || oldPod == nil {
+		warnUnexpectedObject("Pod", "update", oldObj)
+		return
+	}
+	pod, ok := newObj.(*v1.Pod)
+	if !ok || pod == nil {
+		warnUnexpectedObject("Pod", "update", newObj)
+		return
+	}
+	if c.ignoredNamespaces[pod.Namespace] {
+		return
+	}
+	podEvents.WithLabelValues("update").Inc()
+
+	// A resync carries no new status, so there is nothing to check
+	if isResync(oldPod, pod) {
+		slog.Debug("Pod resynced", "event", "resync", "kind", "Pod", "namespace", pod.Namespace, "name", pod.Name)
+		return
+	}
+	c.logPodEvent("Pod updated", "update", pod)
+
+	// Restarts are only checked against crash loops within the circuit
+	// window, and the workload lookup is left to the task worker
+	if c.opts.EnableRestart && c.opts.RestartCircuitWindow > 0 && crashLooping(pod) {
+		c.addTask(task{Kind: taskCrashLoop, Key: pod.Namespace + "/" + pod.Name}, "pod", "update")
+	}
+}
+
+func (c *Controller) onPodDelete(obj any) {
+	var pod *v1.Pod
+	switch obj := obj.(type) {
+	case *v1.Pod:
+		pod = obj
+	case cache.DeletedFinalStateUnknown:
+		pod, _ = obj.Obj.(*v1.Pod)
+	}
+	if pod == nil {
+		warnUnexpectedObject("Pod", "delete", obj)
+		return
+	}
+	if c.ignoredNamespaces[pod.Namespace] {
+		return
+	}
+	podEvents.WithLabelValues("delete").Inc()
+	c.logPodEvent("Pod deleted", "delete", pod)
+}
+
+// warnUnexpectedObject logs an object an event handler could not handle,
+// including the payload type of tombstones.
+func warnUnexpectedObject(kind, event string, obj any) {
+	args := []any{"kind", kind, "event", event, "type", fmt.Sprintf("%T", obj)}
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		args = append(args, "key", tombstone.Key, "tombstoneType", fmt.Sprintf("%T", tombstone.Obj))
+	}
+	slog.Warn("Ignoring unexpected object in event handler", args...)
+}
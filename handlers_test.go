@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/utils/ptr"
+)
+
+func TestConfigMapContentEqual(t *testing.T) {
+	withBinary := func(data map[string]string, binary map[string][]byte) *v1.ConfigMap {
+		cm := testConfigMap("app-config", data)
+		cm.BinaryData = binary
+		return cm
+	}
+	immutable := testConfigMap("app-config", map[string]string{"a": "1"})
+	immutable.Immutable = ptr.To(true)
+
+	tests := []struct {
+		name             string
+		a, b             *v1.ConfigMap
+		data, binaryData bool
+		want             bool
+	}{
+		{
+			name: "same data",
+			a:    testConfigMap("app-config", map[string]string{"a": "1"}),
+			b:    testConfigMap("app-config", map[string]string{"a": "1"}),
+			data: true, binaryData: true,
+			want: true,
+		},
+		{
+			name: "changed data",
+			a:    testConfigMap("app-config", map[string]string{"a": "1"}),
+			b:    testConfigMap("app-config", map[string]string{"a": "2"}),
+			data: true, binaryData: true,
+			want: false,
+		},
+		{
+			name: "changed data not watched",
+			a:    testConfigMap("app-config", map[string]string{"a": "1"}),
+			b:    testConfigMap("app-config", map[string]string{"a": "2"}),
+			data: false, binaryData: true,
+			want: true,
+		},
+		{
+			name: "nil and empty data",
+			a:    testConfigMap("app-config", nil),
+			b:    testConfigMap("app-config", map[string]string{}),
+			data: true, binaryData: true,
+			want: true,
+		},
+		{
+			name: "changed binaryData",
+			a:    withBinary(nil, map[string][]byte{"b": {1}}),
+			b:    withBinary(nil, map[string][]byte{"b": {2}}),
+			data: true, binaryData: true,
+			want: false,
+		},
+		{
+			name: "changed binaryData not watched",
+			a:    withBinary(nil, map[string][]byte{"b": {1}}),
+			b:    withBinary(nil, map[string][]byte{"b": {2}}),
+			data: true, binaryData: false,
+			want: true,
+		},
+		{
+			name: "made immutable",
+			a:    testConfigMap("app-config", map[string]string{"a": "1"}),
+			b:    immutable,
+			data: true, binaryData: true,
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := configMapContentEqual(tt.a, tt.b, tt.data, tt.binaryData); got != tt.want {
+				t.Errorf("configMapContentEqual() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlersIgnoreUnexpectedObjects(t *testing.T) {
+	c, _ := newTestController(t, Options{WatchSecrets: true, EnableRestart: true, RestartCircuitWindow: time.Minute})
+	cm := testConfigMap("app-config", nil)
+	pod := testPod("web", volumeSpec("app-config"))
+	secret := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "creds"}}
+
+	unexpected := []struct {
+		name string
+		obj  any
+	}{
+		{name: "tombstone with nil object", obj: cache.DeletedFinalStateUnknown{Key: "default/gone", Obj: nil}},
+		{name: "tombstone of another kind", obj: cache.DeletedFinalStateUnknown{Key: "default/other", Obj: &v1.Node{}}},
+		{name: "nil", obj: nil},
+		{name: "nil ConfigMap", obj: (*v1.ConfigMap)(nil)},
+		{name: "nil Pod", obj: (*v1.Pod)(nil)},
+		{name: "nil Secret", obj: (*v1.Secret)(nil)},
+	}
+	handlers := []struct {
+		name   string
+		handle func(obj any)
+	}{
+		{name: "onConfigMapAdd", handle: c.onConfigMapAdd},
+		{name: "onConfigMapUpdate old", handle: func(obj any) { c.onConfigMapUpdate(obj, cm) }},
+		{name: "onConfigMapUpdate new", handle: func(obj any) { c.onConfigMapUpdate(cm, obj) }},
+		{name: "onConfigMapDelete", handle: c.onConfigMapDelete},
+		{name: "onPodAdd", handle: c.onPodAdd},
+		{name: "onPodUpdate old", handle: func(obj any) { c.onPodUpdate(obj, pod) }},
+		{name: "onPodUpdate new", handle: func(obj any) { c.onPodUpdate(pod, obj) }},
+		{name: "onPodDelete", handle: c.onPodDelete},
+		{name: "onSecretAdd", handle: c.onSecretAdd},
+		{name: "onSecretUpdate old", handle: func(obj any) { c.onSecretUpdate(obj, secret) }},
+		{name: "onSecretUpdate new", handle: func(obj any) { c.onSecretUpdate(secret, obj) }},
+		{name: "onSecretDelete", handle: c.onSecretDelete},
+		{name: "onReplicaSetDelete", handle: c.onReplicaSetDelete},
+	}
+	for _, h := range handlers {
+		for _, u := range unexpected {
+			t.Run(h.name+"/"+u.name, func(t *testing.T) {
+				h.handle(u.obj)
+				if n := c.queuedWork(); n != 0 {
+					t.Errorf("queued %d items for an unexpected object", n)
+				}
+			})
+		}
+	}
+}
+
+func TestConfigMapUpdatesDebounced(t *testing.T) {
+	const window = 100 * time.Millisecond
+	c, _ := newTestController(t, Options{WatchData: true, DebounceWindow: window})
+
+	versions := []map[string]string{
+		{"a": "1"},
+		{"a": "2"},
+		{"a": "2", "b": "1"},
+		{"a": "3"},
+	}
+	var prev *v1.ConfigMap
+	for i, data := range versions {
+		cm := testConfigMap("app-config", data)
+		cm.ResourceVersion = strconv.Itoa(i + 1)
+		if prev != nil {
+			c.onConfigMapUpdate(prev, cm)
+		}
+		prev = cm
+	}
+	if n := c.queue.Len(); n != 0 {
+		t.Fatalf("queue length right after the updates = %d, want 0 until the debounce window passes", n)
+	}
+
+	start := time.Now()
+	key, _ := c.queue.Get()
+	if waited := time.Since(start); waited < window/2 {
+		t.Errorf("reconcile became ready after %s, want about %s", waited, window)
+	}
+	if key != "default/app-config" {
+		t.Fatalf("queued key = %q, want default/app-config", key)
+	}
+	if got, want := c.takeChangedKeys(key), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changed keys = %v, want %v merged from every update", got, want)
+	}
+	c.queue.Done(key)
+
+	time.Sleep(2 * window)
+	if n := c.queue.Len(); n != 0 {
+		t.Errorf("queue length after one reconcile = %d, want 0", n)
+	}
+}
+
+func TestConfigMapUpdatesWatchedFields(t *testing.T) {
+	tests := []struct {
+		data, binaryData     bool
+		wantData, wantBinary bool
+		wantWarning          bool
+	}{
+		{data: true, binaryData: true, wantData: true, wantBinary: true},
+		{data: true, binaryData: false, wantData: true},
+		{data: false, binaryData: true, wantBinary: true},
+		{data: false, binaryData: false, wantWarning: true},
+	}
+	for _, tt := range tests {
+		t.Run("data="+strconv.FormatBool(tt.data)+"/binaryData="+strconv.FormatBool(tt.binaryData), func(t *testing.T) {
+			var logs bytes.Buffer
+			logger := slog.Default()
+			slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+			t.Cleanup(func() { slog.SetDefault(logger) })
+
+			c, _ := newTestController(t, Options{WatchData: tt.data, WatchBinaryData: tt.binaryData})
+			if got := strings.Contains(logs.String(), "treated as a no-op"); got != tt.wantWarning {
+				t.Errorf("no-op warning logged = %v, want %v", got, tt.wantWarning)
+			}
+
+			update := func(change func(cm *v1.ConfigMap)) bool {
+				old := testConfigMap("app-config", map[string]string{"a": "1"})
+				old.BinaryData = map[string][]byte{"b": {1}}
+				cm := old.DeepCopy()
+				cm.ResourceVersion = "2"
+				change(cm)
+				c.onConfigMapUpdate(old, cm)
+				queued := c.queue.Len() > 0
+				for c.queue.Len() > 0 {
+					key, _ := c.queue.Get()
+					c.queue.Done(key)
+				}
+				return queued
+			}
+			if got := update(func(cm *v1.ConfigMap) { cm.Data["a"] = "2" }); got != tt.wantData {
+				t.Errorf("data change queued = %v, want %v", got, tt.wantData)
+			}
+			if got := update(func(cm *v1.ConfigMap) { cm.BinaryData["b"] = []byte{2} }); got != tt.wantBinary {
+				t.Errorf("binaryData change queued = %v, want %v", got, tt.wantBinary)
+			}
+		})
+	}
+}
+
+func TestConfigMapDeleteForgetsSkipped(t *testing.T) {
+	tests := []struct {
+		name    string
+		deleted func(cm *v1.ConfigMap) any
+	}{
+		{name: "unreferenced", deleted: func(cm *v1.ConfigMap) any { return cm }},
+		{name: "tombstone", deleted: func(cm *v1.ConfigMap) any {
+			return cache.DeletedFinalStateUnknown{Key: "default/app-config", Obj: cm}
+		}},
+		{name: "ignored before the delete", deleted: func(cm *v1.ConfigMap) any {
+			cm = cm.DeepCopy()
+			cm.Annotations = map[string]string{ignoreAnnotation: "true"}
+			return cm
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := testConfigMap("app-config", map[string]string{"level": "info"})
+			c, _ := newTestController(t, Options{ReferencedOnly: true})
+			startTestInformers(t, c)
+
+			c.onConfigMapAdd(cm)
+			if !c.skippedConfigMaps["default/app-config"] {
+				t.Fatalf("skippedConfigMaps = %v, want default/app-config skipped", c.skippedConfigMaps)
+			}
+			c.onConfigMapDelete(tt.deleted(cm))
+			if len(c.skippedConfigMaps) != 0 {
+				t.Errorf("skippedConfigMaps after delete = %v, want empty", c.skippedConfigMaps)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// runHealthCheck queries the /readyz endpoint of a watcher serving on addr
+// and returns the process exit code: 0 when ready, 1 otherwise. With useTLS
+// the query uses HTTPS without verifying the certificate, whose names
+// rarely cover localhost.
+func runHealthCheck(addr string, useTLS bool) int {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		slog.Error("Invalid address for health check", "addr", addr, "err", err)
+		return 1
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	scheme := "http"
+	client := &http.Client{Timeout: 5 * time.Second}
+	if useTLS {
+		scheme = "https"
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+	url := fmt.Sprintf("%s://%s/readyz", scheme, net.JoinHostPort(host, port))
+
+	resp, err := client.Get(url)
+	if err != nil {
+		slog.Error("Health check failed", "url", url, "err", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.Error("Health check failed", "url", url, "status", resp.Status)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// buildConfig resolves the REST config from, in order, an explicit kubeconfig
+// path or context, the files listed in $KUBECONFIG, the in-cluster service
+// account, and the default kubeconfig loading rules. The chosen source and
+// API server host are logged.
+func buildConfig(kubeconfig, kubeContext string) (*rest.Config, error) {
+	if kubeconfig != "" || kubeContext != "" {
+		cfg, err := loadKubeconfig(kubeconfig, kubeContext)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Using kubeconfig from flags", "path", kubeconfig, "context", kubeContext, "host", cfg.Host)
+		return cfg, nil
+	}
+
+	// The default loading rules merge every file in $KUBECONFIG
+	if env := os.Getenv(clientcmd.RecommendedConfigPathEnvVar); env != "" {
+		cfg, err := loadKubeconfig("", "")
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("Using kubeconfig from environment", "env", clientcmd.RecommendedConfigPathEnvVar, "paths", filepath.SplitList(env), "host", cfg.Host)
+		return cfg, nil
+	}
+
+	cfg, err := rest.InClusterConfig()
+	if err == nil {
+		slog.Info("Using in-cluster config", "host", cfg.Host)
+		return cfg, nil
+	}
+	if !errors.Is(err, rest.ErrNotInCluster) {
+		slog.Warn("In-cluster config unavailable, falling back to default loading rules", "err", err)
+	}
+
+	cfg, err = loadKubeconfig("", "")
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Using default kubeconfig loading rules", "paths", clientcmd.NewDefaultClientConfigLoadingRules().GetLoadingPrecedence(), "host", cfg.Host)
+	return cfg, nil
+}
+
+// loadKubeconfig loads a kubeconfig from path, or from the default loading
+// rules when path is empty, optionally switching to the named context.
+func loadKubeconfig(path, kubeContext string) (*rest.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = path
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules,
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext})
+
+	if kubeContext != "" {
+		raw, err := clientConfig.RawConfig()
+		if err != nil {
+			return nil, fmt.Errorf("loading kubeconfig: %w", err)
+		}
+		if _, ok := raw.Contexts[kubeContext]; !ok {
+			return nil, fmt.Errorf("context %q not found in kubeconfig", kubeContext)
+		}
+	}
+
+	cfg, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeKubeconfig writes a kubeconfig with one cluster, user and context all
+// called name, pointing at host, and returns its path. current makes the
+// context the current one.
+func writeKubeconfig(t *testing.T, name, host string, current bool) string {
+	t.Helper()
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: %[1]s
+  cluster:
+    server: %[2]s
+users:
+- name: %[1]s
+  user:
+    token: secret
+contexts:
+- name: %[1]s
+  context:
+    cluster: %[1]s
+    user: %[1]s
+`, name, host)
+	if current {
+		config += "current-context: " + name + "\n"
+	}
+	path := filepath.Join(t.TempDir(), name+".yaml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatalf("writing kubeconfig: %v", err)
+	}
+	return path
+}
+
+func TestBuildConfigFromEnv(t *testing.T) {
+	staging := writeKubeconfig(t, "staging", "https://staging.example.com", true)
+	prod := writeKubeconfig(t, "prod", "https://prod.example.com", false)
+	explicit := writeKubeconfig(t, "explicit", "https://explicit.example.com", true)
+
+	tests := []struct {
+		name        string
+		env         string
+		kubeconfig  string
+		kubeContext string
+		wantHost    string
+	}{
+		{name: "single file", env: staging, wantHost: "https://staging.example.com"},
+		{name: "files merged", env: prod + string(os.PathListSeparator) + staging, wantHost: "https://staging.example.com"},
+		{name: "context from merged files", env: staging + string(os.PathListSeparator) + prod, kubeContext: "prod", wantHost: "https://prod.example.com"},
+		{name: "flag overrides env", env: staging, kubeconfig: explicit, wantHost: "https://explicit.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("KUBECONFIG", tt.env)
+			cfg, err := buildConfig(tt.kubeconfig, tt.kubeContext)
+			if err != nil {
+				t.Fatalf("buildConfig: %v", err)
+			}
+			if cfg.Host != tt.wantHost {
+				t.Errorf("host = %q, want %q", cfg.Host, tt.wantHost)
+			}
+		})
+	}
+}
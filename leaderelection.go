@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// runWithLeaderElection blocks until ctx is done or leadership is lost,
+// calling run only while this replica holds the Lease. The context passed to
+// run is cancelled as soon as leadership is lost, which stops the informers
+// and workers, and a started run is waited for before returning
+// errLeadershipLost.
+func (c *Controller) runWithLeaderElection(ctx context.Context, run func(context.Context)) error {
+	namespace, name := c.opts.LeaderElectionNamespace, c.opts.LeaderElectionID
+
+	id, err := os.Hostname()
+	if err != nil {
+		return fmt.Errorf("getting hostname for leader election identity: %w", err)
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Client: c.clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: id,
+		},
+	}
+
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	var lost bool
+
+	c.standby.Store(true)
+	slog.Info("Waiting for leadership", "lease", namespace+"/"+name, "identity", id)
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   15 * time.Second,
+		RenewDeadline:   10 * time.Second,
+		RetryPeriod:     2 * time.Second,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				close(started)
+				defer close(finished)
+				c.standby.Store(false)
+				slog.Info("Acquired leadership", "identity", id)
+				run(ctx)
+			},
+			OnStoppedLeading: func() {
+				if ctx.Err() == nil {
+					lost = true
+					slog.Error("Leadership lost", "identity", id)
+					return
+				}
+				slog.Info("Released leadership", "identity", id)
+			},
+			OnNewLeader: func(identity string) {
+				if identity != id {
+					slog.Info("New leader elected", "leader", identity)
+				}
+			},
+		},
+	})
+
+	select {
+	case <-started:
+		<-finished
+	default:
+	}
+	if lost {
+		return errLeadershipLost
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// logLevel controls the level of the default logger.
+var logLevel = new(slog.LevelVar)
+
+// setupLogger installs the default slog logger using the given output format
+// ("text" or "json") and minimum level.
+func setupLogger(format, level string) error {
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: logLevel}
+
+	var handler slog.Handler
+	switch format {
+	case "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q: must be text or json", format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+type loggerKey struct{}
+
+// withLogger returns a copy of ctx carrying logger.
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFrom returns the logger carried by ctx, or the default logger.
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// logReferencingPods logs that each pod references the resource stored
+// under key, with attr set to key, for up to the -log-pod-list-limit pods
+// followed by a summary of the rest. extra, if not nil, returns additional
+// attributes for a pod. With -group-by-owner the pods are logged per
+// workload returned by owner instead; event handlers pass cachedWorkload
+// so they never wait on the API server.
+func (c *Controller) logReferencingPods(ctx context.Context, pods []any, resource, attr, key string, owner func(pod *v1.Pod) workloadRef,
+	extra func(pod *v1.Pod) []any) {
+	if c.opts.GroupByOwner {
+		c.logReferencingWorkloads(ctx, pods, resource, attr, key, owner, extra)
+		return
+	}
+	logger := loggerFrom(ctx)
+	logged := 0
+	for _, obj := range pods {
+		if c.opts.LogPodListLimit > 0 && logged == c.opts.LogPodListLimit {
+			break
+		}
+		if pod, ok := obj.(*v1.Pod); ok {
+			args := []any{"kind", "Pod", "namespace", pod.Namespace, "name", pod.Name, attr, key}
+			if extra != nil {
+				args = append(args, extra(pod)...)
+			}
+			logger.Info("Pod references "+resource, args...)
+		}
+		logged++
+	}
+	if more := len(pods) - logged; more > 0 {
+		logger.Info(fmt.Sprintf("... and %d more", more), attr, key, "total", len(pods))
+	}
+}
+
+// logReferencingWorkloads logs one line per owner of pods with the number
+// of its pods, and one line per pod without a controller, for up to
+// -log-pod-list-limit lines. Pods of one workload share its template, so
+// extra is evaluated for the first pod of each.
+func (c *Controller) logReferencingWorkloads(ctx context.Context, pods []any, resource, attr, key string, owner func(pod *v1.Pod) workloadRef,
+	extra func(pod *v1.Pod) []any) {
+	type ownerPods struct {
+		ref   workloadRef
+		first *v1.Pod
+		count int
+	}
+	// Sibling pods share their controller, so it is resolved once
+	resolved := make(map[types.UID]workloadRef)
+	owners := make(map[workloadRef]*ownerPods)
+	var order []*ownerPods
+	for _, obj := range pods {
+		pod, ok := obj.(*v1.Pod)
+		if !ok {
+			continue
+		}
+		var ref workloadRef
+		if controller := metav1.GetControllerOf(pod); controller == nil {
+			ref = workloadRef{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name}
+		} else if cached, ok := resolved[controller.UID]; ok {
+			ref = cached
+		} else {
+			ref = owner(pod)
+			resolved[controller.UID] = ref
+		}
+		entry := owners[ref]
+		if entry == nil {
+			entry = &ownerPods{ref: ref, first: pod}
+			owners[ref] = entry
+			order = append(order, entry)
+		}
+		entry.count++
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i].ref.String() < order[j].ref.String() })
+
+	logger := loggerFrom(ctx)
+	logged := 0
+	for _, entry := range order {
+		if c.opts.LogPodListLimit > 0 && logged == c.opts.LogPodListLimit {
+			break
+		}
+		msg := "Workload references " + resource
+		args := []any{"kind", entry.ref.Kind, "namespace", entry.ref.Namespace, "name", entry.ref.Name, attr, key}
+		if entry.ref.Kind == "Pod" {
+			msg = "Pod references " + resource
+		} else {
+			args = append(args, "pods", entry.count)
+		}
+		if extra != nil {
+			args = append(args, extra(entry.first)...)
+		}
+		logger.Info(msg, args...)
+		logged++
+	}
+	if more := len(order) - logged; more > 0 {
+		logger.Info(fmt.Sprintf("... and %d more workloads", more), attr, key, "total", len(order))
+	}
+}
+
+// truncatePodList returns at most -log-pod-list-limit names and the number left
+// out.
+func (c *Controller) truncatePodList(names []string) ([]string, int) {
+	if c.opts.LogPodListLimit <= 0 || len(names) <= c.opts.LogPodListLimit {
+		return names, 0
+	}
+	return names[:c.opts.LogPodListLimit], len(names) - c.opts.LogPodListLimit
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// podLogSummaryInterval is how often the number of Pod event lines dropped
+// by -pod-log-sample-rate is logged.
+const podLogSummaryInterval = 10 * time.Second
+
+// logPodEvent logs a Pod event at info level unless -pod-log-sample-rate is
+// set and its budget for the current second is spent, in which case the line
+// is only counted.
+func (c *Controller) logPodEvent(msg, event string, pod *v1.Pod) {
+	if c.podLogLimiter != nil && !c.podLogLimiter.Allow() {
+		c.suppressedPodLogs.Add(1)
+		return
+	}
+	slog.Info(msg, "event", event, "kind", "Pod", "namespace", pod.Namespace, "name", pod.Name)
+}
+
+// summarizeSuppressedPodLogs periodically logs how many Pod event lines were
+// dropped by sampling until stopCh is closed.
+func (c *Controller) summarizeSuppressedPodLogs(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(podLogSummaryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if n := c.suppressedPodLogs.Swap(0); n > 0 {
+				slog.Info("Suppressed Pod event log lines", "count", n, "interval", podLogSummaryInterval,
+					"podLogSampleRate", c.opts.PodLogSampleRate)
+			}
+		}
+	}
+}
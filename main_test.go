@@ -0,0 +1,13 @@
+package main
+
+import (
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+// TestMain fails the package when a test leaves goroutines behind, such as
+// informers or workers that outlive Run or Report.
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	configMapEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "configmap_events_total",
+		Help: "Number of ConfigMap events handled, by event type.",
+	}, []string{"type"})
+
+	podEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "pod_events_total",
+		Help: "Number of Pod events handled, by event type.",
+	}, []string{"type"})
+
+	secretEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "secret_events_total",
+		Help: "Number of Secret events handled, by event type.",
+	}, []string{"type"})
+
+	restartsSkippedDryRun = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "restarts_skipped_dry_run_total",
+		Help: "Number of workload restarts skipped because -dry-run is set.",
+	})
+
+	restartsRateLimited = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "restarts_rate_limited_total",
+		Help: "Number of workload restarts deferred by -max-restarts-per-minute.",
+	})
+
+	restartCircuitOpen = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "restart_circuit_open_total",
+		Help: "Number of times a ConfigMap's restart circuit opened because Pods crash-looped after a restart.",
+	})
+
+	webhookRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "webhook_retries_total",
+		Help: "Number of webhook notifications scheduled for another attempt after a failure.",
+	})
+
+	webhookDeliveryFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "webhook_delivery_failures_total",
+		Help: "Number of webhook notifications given up on and logged as dead letters.",
+	})
+
+	stuckPodsRestarted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "stuck_pods_restarted_total",
+		Help: "Number of Pods stuck in CreateContainerConfigError deleted by -restart-stuck-pods once their ConfigMap was created.",
+	})
+
+	configMapMirrorWrites = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "configmap_mirror_writes_total",
+		Help: "Number of ConfigMap mirrors written by -mirror-configmap, by action.",
+	}, []string{"action"})
+
+	reconcileDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "reconcile_duration_seconds",
+		Help:    "Time spent reconciling a ConfigMap, by result.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"result"})
+
+	missingRequiredConfigMapRefs = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "missing_required_configmap_refs_total",
+		Help: "Number of non-optional Pod references to ConfigMaps missing from the cache.",
+	})
+
+	watchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "watch_errors_total",
+		Help: "Number of informer list/watch failures, by resource.",
+	}, []string{"resource"})
+
+	eventsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_dropped_total",
+		Help: "Number of handler tasks and resyncs shed because the work queues were at -max-queue-depth, by resource and event type.",
+	}, []string{"resource", "type"})
+
+	informerCacheObjects = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "informer_cache_objects",
+		Help: "Number of objects in an informer cache, by resource.",
+	}, []string{"resource"})
+
+	informerLastSync = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "informer_last_sync_timestamp_seconds",
+		Help: "Unix time at which an informer's last synced resourceVersion was first seen to change, by resource.",
+	}, []string{"resource"})
+)
+
+// sampleInformerMetrics updates the informer cache gauges every
+// InformerMetricsInterval until stopCh is closed. An informer counts as
+// synced whenever its last synced resourceVersion moved since the previous
+// sample, which happens on every list, watch event and bookmark.
+func (c *Controller) sampleInformerMetrics(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(c.opts.InformerMetricsInterval)
+	defer ticker.Stop()
+
+	versions := make(map[string]string)
+	for {
+		now := time.Now()
+		for resource, informer := range c.watchedInformers() {
+			informerCacheObjects.WithLabelValues(resource).Set(float64(len(informer.GetStore().ListKeys())))
+			if rv := informer.LastSyncResourceVersion(); rv != versions[resource] {
+				versions[resource] = rv
+				informerLastSync.WithLabelValues(resource).Set(float64(now.Unix()))
+			}
+		}
+
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// countReferencingPods backs the pods_referencing_configmaps gauge.
+func (c *Controller) countReferencingPods() float64 {
+	indexer := c.podInformer.GetIndexer()
+	pods := make(map[string]struct{})
+	for _, key := range indexer.ListIndexFuncValues("configMapRef") {
+		podKeys, err := indexer.IndexKeys("configMapRef", key)
+		if err != nil {
+			continue
+		}
+		for _, podKey := range podKeys {
+			pods[podKey] = struct{}{}
+		}
+	}
+	for _, informer := range c.reloaderWorkloadInformers() {
+		for _, key := range informer.GetIndexer().ListIndexFuncValues("reloaderConfigMapRef") {
+			reloaderPods, err := c.reloaderPods(key)
+			if err != nil {
+				continue
+			}
+			for _, pod := range reloaderPods {
+				pods[pod.Namespace+"/"+pod.Name] = struct{}{}
+			}
+		}
+	}
+	return float64(len(pods))
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// mirroredFromAnnotation holds the namespace/name of the source of a
+// ConfigMap written by -mirror-configmap. ConfigMaps carrying it are never
+// mirrored themselves, and only ConfigMaps carrying their source's key are
+// overwritten or deleted.
+const mirroredFromAnnotation = "config-watcher/mirrored-from"
+
+// mirrorRule copies the data of the Source ConfigMap to Target.
+type mirrorRule struct {
+	Source objectRef
+	Target objectRef
+}
+
+// parseMirrorRule parses a -mirror-configmap rule of the form
+// "namespace/name -> namespace/name".
+func parseMirrorRule(rule string) (mirrorRule, error) {
+	source, target, ok := strings.Cut(rule, "->")
+	if !ok {
+		return mirrorRule{}, fmt.Errorf("%q is not of the form namespace/name -> namespace/name", rule)
+	}
+	var r mirrorRule
+	var err error
+	if r.Source, err = parseObjectKey(strings.TrimSpace(source)); err != nil {
+		return mirrorRule{}, fmt.Errorf("source of %q: %w", rule, err)
+	}
+	if r.Target, err = parseObjectKey(strings.TrimSpace(target)); err != nil {
+		return mirrorRule{}, fmt.Errorf("target of %q: %w", rule, err)
+	}
+	return r, nil
+}
+
+// parseObjectKey parses a namespace/name key.
+func parseObjectKey(key string) (objectRef, error) {
+	ns, name, ok := strings.Cut(key, "/")
+	if !ok || ns == "" || name == "" || strings.Contains(name, "/") {
+		return objectRef{}, fmt.Errorf("%q is not of the form namespace/name", key)
+	}
+	return objectRef{Namespace: ns, Name: name}, nil
+}
+
+// queueMirror queues cm for mirroring when it is the source of a
+// -mirror-configmap rule. Every event is queued, resyncs included, so
+// mirrors edited by hand are restored.
+func (c *Controller) queueMirror(cm *v1.ConfigMap, event string) {
+	key := cm.Namespace + "/" + cm.Name
+	if _, ok := c.mirrors[key]; !ok {
+		return
+	}
+	// A mirror written by this or another watcher is never mirrored again,
+	// so rules cannot chase each other in a loop
+	if from, ok := cm.Annotations[mirroredFromAnnotation]; ok {
+		slog.Debug("Not mirroring ConfigMap written by a mirror", "event", event, "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name,
+			"mirroredFrom", from)
+		return
+	}
+	c.mirrorQueue.Add(key)
+}
+
+func (c *Controller) runMirrorWorker(ctx context.Context) {
+	for c.processNextMirror(ctx) {
+	}
+}
+
+func (c *Controller) processNextMirror(ctx context.Context) bool {
+	key, quit := c.mirrorQueue.Get()
+	if quit {
+		return false
+	}
+	defer c.mirrorQueue.Done(key)
+
+	err := c.syncMirrors(ctx, key)
+	switch {
+	case err == nil:
+		c.mirrorQueue.Forget(key)
+	case c.mirrorQueue.NumRequeues(key) < maxRetries:
+		slog.Warn("Error mirroring ConfigMap, retrying", "key", key, "err", err)
+		c.mirrorQueue.AddRateLimited(key)
+	default:
+		c.mirrorQueue.Forget(key)
+		slog.Error("Dropping ConfigMap mirror out of the queue", "key", key, "retries", maxRetries, "err", err)
+	}
+	return true
+}
+
+// syncMirrors brings every mirror of the ConfigMap stored under key in line
+// with it: copying its data while it exists and, with -mirror-delete,
+// deleting the mirrors once it is gone.
+func (c *Controller) syncMirrors(ctx context.Context, key string) error {
+	obj, exists, err := c.configMapInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, target := range c.mirrors[key] {
+		switch {
+		case exists:
+			errs = append(errs, c.writeMirror(ctx, obj.(*v1.ConfigMap), target))
+		case c.opts.MirrorDelete:
+			errs = append(errs, c.deleteMirror(ctx, key, target))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeMirror creates or updates target with the data and binaryData of
+// source. A target that is not a mirror of source is left untouched.
+func (c *Controller) writeMirror(ctx context.Context, source *v1.ConfigMap, target objectRef) error {
+	key := source.Namespace + "/" + source.Name
+	configMaps := c.clientset.CoreV1().ConfigMaps(target.Namespace)
+	current, err := configMaps.Get(ctx, target.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if c.dryRun.Load() {
+			slog.Info("Would create ConfigMap mirror (dry run)", "event", "mirror", "source", key, "namespace", target.Namespace, "name", target.Name)
+			return nil
+		}
+		mirror := &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   target.Namespace,
+				Name:        target.Name,
+				Annotations: map[string]string{mirroredFromAnnotation: key},
+			},
+			Data:       source.Data,
+			BinaryData: source.BinaryData,
+		}
+		if _, err := configMaps.Create(ctx, mirror, metav1.CreateOptions{FieldManager: c.opts.FieldManager}); err != nil {
+			return fmt.Errorf("creating mirror %s/%s: %w", target.Namespace, target.Name, err)
+		}
+		configMapMirrorWrites.WithLabelValues("create").Inc()
+		slog.Info("Created ConfigMap mirror", "event", "mirror", "source", key, "namespace", target.Namespace, "name", target.Name)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting mirror %s/%s: %w", target.Namespace, target.Name, err)
+	}
+
+	if from := current.Annotations[mirroredFromAnnotation]; from != key {
+		slog.Error("Not overwriting ConfigMap that is not a mirror of the source", "source", key, "namespace", target.Namespace, "name", target.Name,
+			"annotation", mirroredFromAnnotation, "mirroredFrom", from)
+		return nil
+	}
+	if maps.Equal(current.Data, source.Data) && maps.EqualFunc(current.BinaryData, source.BinaryData, bytes.Equal) {
+		return nil
+	}
+	if c.dryRun.Load() {
+		slog.Info("Would update ConfigMap mirror (dry run)", "event", "mirror", "source", key, "namespace", target.Namespace, "name", target.Name)
+		return nil
+	}
+	mirror := current.DeepCopy()
+	mirror.Data = source.Data
+	mirror.BinaryData = source.BinaryData
+	if _, err := configMaps.Update(ctx, mirror, metav1.UpdateOptions{FieldManager: c.opts.FieldManager}); err != nil {
+		return fmt.Errorf("updating mirror %s/%s: %w", target.Namespace, target.Name, err)
+	}
+	configMapMirrorWrites.WithLabelValues("update").Inc()
+	slog.Info("Updated ConfigMap mirror", "event", "mirror", "source", key, "namespace", target.Namespace, "name", target.Name)
+	return nil
+}
+
+// deleteMirror deletes target if it is a mirror of the ConfigMap stored
+// under key.
+func (c *Controller) deleteMirror(ctx context.Context, key string, target objectRef) error {
+	configMaps := c.clientset.CoreV1().ConfigMaps(target.Namespace)
+	current, err := configMaps.Get(ctx, target.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("getting mirror %s/%s: %w", target.Namespace, target.Name, err)
+	}
+	if current.Annotations[mirroredFromAnnotation] != key {
+		return nil
+	}
+	if c.dryRun.Load() {
+		slog.Info("Would delete ConfigMap mirror (dry run)", "event", "mirror", "source", key, "namespace", target.Namespace, "name", target.Name)
+		return nil
+	}
+	// The precondition keeps a mirror recreated in the meantime
+	err = configMaps.Delete(ctx, target.Name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &current.UID}})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("deleting mirror %s/%s: %w", target.Namespace, target.Name, err)
+	}
+	configMapMirrorWrites.WithLabelValues("delete").Inc()
+	slog.Info("Deleted ConfigMap mirror", "event", "mirror", "source", key, "namespace", target.Namespace, "name", target.Name)
+	return nil
+}
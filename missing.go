@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// checkRequiredConfigMaps warns about every non-optional ConfigMap the pod
+// references that is not in the informer cache. It is a no-op until caches
+// have synced, and when ConfigMaps are filtered by label since filtered-out
+// ConfigMaps would look missing.
+func (c *Controller) checkRequiredConfigMaps(pod *v1.Pod) {
+	if !c.cachesSynced.Load() || c.configMapsFiltered {
+		return
+	}
+
+	for _, name := range c.requiredConfigMapsForPod(pod) {
+		key := pod.Namespace + "/" + name
+		_, exists, err := c.configMapInformer.GetStore().GetByKey(key)
+		if err != nil || exists {
+			continue
+		}
+		missingRequiredConfigMapRefs.Inc()
+		slog.Warn("Pod references missing required ConfigMap", "kind", "Pod", "namespace", pod.Namespace, "name", pod.Name, "configMap", key)
+	}
+}
+
+// checkAllRequiredConfigMaps runs checkRequiredConfigMaps for every cached pod.
+func (c *Controller) checkAllRequiredConfigMaps() {
+	for _, obj := range c.podInformer.GetStore().List() {
+		if pod, ok := obj.(*v1.Pod); ok && !c.ignoredNamespaces[pod.Namespace] {
+			c.checkRequiredConfigMaps(pod)
+		}
+	}
+}
+
+// warnReferencedConfigMapDeleted warns when the ConfigMap stored under key
+// was deleted while still referenced by cached pods, logging it and
+// recording a Warning event on the workload owning each affected pod, or on
+// the pod itself when it has no restartable owner. It runs as a task since
+// the owners may be looked up from the API server, and does nothing once
+// the ConfigMap has been recreated.
+func (c *Controller) warnReferencedConfigMapDeleted(ctx context.Context, key string) error {
+	if _, exists, err := c.configMapInformer.GetStore().GetByKey(key); err != nil || exists {
+		return err
+	}
+	// The pod index is unaffected by the deletion, so references can still
+	// be looked up
+	pods, err := c.podsReferencingConfigMap(key)
+	if err != nil {
+		return fmt.Errorf("fetching pods from index: %w", err)
+	}
+	if len(pods) == 0 {
+		return nil
+	}
+	namespace, name, _ := strings.Cut(key, "/")
+	slog.Warn("ConfigMap deleted while still referenced by Pods", "kind", "ConfigMap", "namespace", namespace, "name", name, "pods", len(pods))
+
+	seen := make(map[workloadRef]bool)
+	for _, obj := range pods {
+		pod, ok := obj.(*v1.Pod)
+		if !ok {
+			continue
+		}
+
+		var target runtime.Object = pod
+		if ref, ok, err := c.resolveWorkload(ctx, pod); err == nil && ok {
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			if workload, _, err := c.getWorkload(ctx, ref); err == nil {
+				target = workload.(runtime.Object)
+			}
+		}
+		c.recorder.Eventf(target, v1.EventTypeWarning, "ConfigMapDeleted",
+			"Referenced ConfigMap %s was deleted; Pods restarted or rescheduled will fail to start unless the reference is optional", key)
+	}
+	return nil
+}
+
+// createContainerConfigError is the waiting reason of containers whose
+// environment references a ConfigMap or Secret that does not exist.
+const createContainerConfigError = "CreateContainerConfigError"
+
+// stuckOnContainerConfig reports whether a container of pod is waiting with
+// createContainerConfigError.
+func stuckOnContainerConfig(pod *v1.Pod) bool {
+	for _, statuses := range [][]v1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for _, status := range statuses {
+			if status.State.Waiting != nil && status.State.Waiting.Reason == createContainerConfigError {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkDanglingReferences reports the cached pods that already referenced
+// the ConfigMap stored under key when it was created, and with
+// -restart-stuck-pods queues a restart of those stuck in
+// CreateContainerConfigError so their controllers replace them right away
+// instead of waiting for kubelet's next retry. It runs as a task, and does
+// nothing once the ConfigMap is gone again.
+func (c *Controller) checkDanglingReferences(key string) error {
+	obj, exists, err := c.configMapInformer.GetStore().GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("fetching ConfigMap %s from store: %w", key, err)
+	}
+	cm, ok := obj.(*v1.ConfigMap)
+	if !exists || !ok {
+		return nil
+	}
+	objs, err := c.podsReferencingConfigMap(key)
+	if err != nil {
+		return fmt.Errorf("fetching pods from index: %w", err)
+	}
+	if len(objs) == 0 {
+		return nil
+	}
+
+	var stuck []*v1.Pod
+	for _, obj := range objs {
+		if pod, ok := obj.(*v1.Pod); ok && pod.DeletionTimestamp == nil && stuckOnContainerConfig(pod) {
+			stuck = append(stuck, pod)
+		}
+	}
+	slog.Info("Previously missing ConfigMap created", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name,
+		"pods", len(objs), "stuckPods", len(stuck))
+	c.recorder.Eventf(cm, v1.EventTypeNormal, "WaitingPodsFound", "ConfigMap created while referenced by %d Pods, %d of them stuck in %s",
+		len(objs), len(stuck), createContainerConfigError)
+	for _, pod := range stuck {
+		slog.Info("Pod stuck waiting for created ConfigMap", "kind", "Pod", "namespace", pod.Namespace, "name", pod.Name, "configMap", key,
+			"reason", createContainerConfigError)
+		if c.opts.RestartStuckPods {
+			c.addTask(task{Kind: taskRestartStuckPod, Key: pod.Namespace + "/" + pod.Name, ConfigMap: key}, "pod", "restart")
+		}
+	}
+	return nil
+}
+
+// restartStuckPod deletes the pod stored under podKey, stuck waiting for the
+// ConfigMap stored under key, so its controller recreates it. Pods no longer
+// stuck, pods without a controller to replace them and pods whose other
+// required ConfigMaps are still missing are left alone. Like workload
+// restarts, it honours -restart-namespaces, -dry-run, the cooldown of the
+// owning workload, whose rollout replaces the pod anyway, and
+// -max-restarts-per-minute, deferring the deletion while the namespace is
+// over its limit.
+func (c *Controller) restartStuckPod(ctx context.Context, podKey, key string) error {
+	obj, exists, err := c.podInformer.GetIndexer().GetByKey(podKey)
+	if err != nil {
+		return fmt.Errorf("fetching Pod %s from store: %w", podKey, err)
+	}
+	pod, ok := obj.(*v1.Pod)
+	if !exists || !ok || pod.DeletionTimestamp != nil || !stuckOnContainerConfig(pod) {
+		return nil
+	}
+	if c.restartNamespaces != nil && !c.restartNamespaces[pod.Namespace] {
+		return nil
+	}
+	if metav1.GetControllerOf(pod) == nil {
+		slog.Info("Not restarting stuck Pod without a controller to replace it", "kind", "Pod", "namespace", pod.Namespace, "name", pod.Name,
+			"configMap", key)
+		return nil
+	}
+	for _, name := range c.requiredConfigMapsForPod(pod) {
+		if _, exists, err := c.configMapInformer.GetStore().GetByKey(pod.Namespace + "/" + name); err == nil && !exists {
+			slog.Info("Not restarting stuck Pod, another required ConfigMap is still missing", "kind", "Pod", "namespace", pod.Namespace,
+				"name", pod.Name, "configMap", key, "missing", pod.Namespace+"/"+name)
+			return nil
+		}
+	}
+	if c.dryRun.Load() {
+		slog.Info("Would restart stuck Pod (dry run)", "event", "restart", "kind", "Pod", "namespace", pod.Namespace, "name", pod.Name, "configMap", key)
+		return nil
+	}
+	ref, ok, err := c.resolveWorkload(ctx, pod)
+	if err != nil {
+		return fmt.Errorf("resolving owner of Pod %s: %w", podKey, err)
+	}
+	if ok && c.inRestartCooldown(ref) {
+		slog.Info("Workload of stuck Pod restarted recently, leaving the Pod to its rollout", "kind", "Pod", "namespace", pod.Namespace, "name", pod.Name,
+			"configMap", key, "workload", ref.String(), "cooldown", c.opts.RestartCooldown)
+		return nil
+	}
+	if !c.allowRestart(pod.Namespace) {
+		restartsRateLimited.Inc()
+		return &restartsDeferredError{Deferred: 1, Reason: "rate limit", RetryAfter: c.restartInterval()}
+	}
+
+	// The precondition spares a replacement that reused the name
+	err = c.clientset.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &pod.UID}})
+	if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("deleting stuck Pod %s: %w", podKey, err)
+	}
+	stuckPodsRestarted.Inc()
+	slog.Info("Restarted Pod stuck waiting for created ConfigMap", "event", "restart", "kind", "Pod", "namespace", pod.Namespace, "name", pod.Name,
+		"configMap", key)
+	return nil
+}
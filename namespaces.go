@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// namespaceFactories are the informer factories of one watched namespace;
+// the namespace is empty when watching the whole cluster.
+type namespaceFactories struct {
+	namespace string
+	informers informers.SharedInformerFactory
+	// configMaps is informers unless ConfigMaps are filtered by label.
+	configMaps informers.SharedInformerFactory
+	pods       informers.SharedInformerFactory
+}
+
+// watchedNamespaces returns the namespaces that get their own informers:
+// the -namespaces list, or else the single -namespace, empty for all.
+func watchedNamespaces(opts Options) []string {
+	if len(opts.Namespaces) > 0 {
+		return opts.Namespaces
+	}
+	return []string{opts.Namespace}
+}
+
+// newNamespaceFactories creates the informer factories scoped to namespace.
+func (c *Controller) newNamespaceFactories(namespace string) namespaceFactories {
+	f := namespaceFactories{namespace: namespace}
+	f.informers = informers.NewSharedInformerFactoryWithOptions(c.clientset, c.opts.ResyncPeriod,
+		informers.WithNamespace(namespace))
+
+	// ConfigMaps get their own factory when filtered by label so the
+	// selector does not apply to Pods
+	f.configMaps = f.informers
+	if c.configMapsFiltered {
+		selector := c.opts.ConfigMapSelector.String()
+		f.configMaps = informers.NewSharedInformerFactoryWithOptions(c.clientset, c.opts.ResyncPeriod,
+			informers.WithNamespace(namespace),
+			informers.WithTweakListOptions(func(listOpts *metav1.ListOptions) {
+				listOpts.LabelSelector = selector
+			}))
+	}
+
+	// Pods get their own factory so the initial list is chunked and can be
+	// narrowed by field selector without affecting other resources
+	podSelector := c.opts.PodFieldSelector.String()
+	f.pods = informers.NewSharedInformerFactoryWithOptions(c.clientset, c.opts.ResyncPeriod,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(listOpts *metav1.ListOptions) {
+			listOpts.Limit = podListPageSize
+			listOpts.FieldSelector = podSelector
+		}))
+	return f
+}
+
+// combineInformers returns the informer that get picks from each factory
+// set. With several namespaces the informers are combined into one, so
+// handlers, indexes and lookups span every namespace.
+func combineInformers(factories []namespaceFactories, get func(namespaceFactories) cache.SharedIndexInformer) cache.SharedIndexInformer {
+	if len(factories) == 1 {
+		return get(factories[0])
+	}
+	m := &multiNamespaceInformer{byNamespace: make(map[string]cache.SharedIndexInformer, len(factories))}
+	for _, f := range factories {
+		informer := get(f)
+		m.informers = append(m.informers, informer)
+		m.byNamespace[f.namespace] = informer
+	}
+	return m
+}
+
+// multiNamespaceInformer fans a SharedIndexInformer out over one informer per
+// namespace. Event handlers, indexers and watch error handlers are added to
+// every informer, and it has synced once all of them have.
+type multiNamespaceInformer struct {
+	informers   []cache.SharedIndexInformer
+	byNamespace map[string]cache.SharedIndexInformer
+}
+
+var _ cache.SharedIndexInformer = (*multiNamespaceInformer)(nil)
+
+// multiRegistration is the handler registration on every informer.
+type multiRegistration []cache.ResourceEventHandlerRegistration
+
+func (r multiRegistration) HasSynced() bool {
+	for _, reg := range r {
+		if !reg.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *multiNamespaceInformer) AddEventHandler(handler cache.ResourceEventHandler) (cache.ResourceEventHandlerRegistration, error) {
+	return m.addEventHandler(func(i cache.SharedIndexInformer) (cache.ResourceEventHandlerRegistration, error) {
+		return i.AddEventHandler(handler)
+	})
+}
+
+func (m *multiNamespaceInformer) AddEventHandlerWithResyncPeriod(handler cache.ResourceEventHandler, resyncPeriod time.Duration) (cache.ResourceEventHandlerRegistration, error) {
+	return m.addEventHandler(func(i cache.SharedIndexInformer) (cache.ResourceEventHandlerRegistration, error) {
+		return i.AddEventHandlerWithResyncPeriod(handler, resyncPeriod)
+	})
+}
+
+func (m *multiNamespaceInformer) AddEventHandlerWithOptions(handler cache.ResourceEventHandler, options cache.HandlerOptions) (cache.ResourceEventHandlerRegistration, error) {
+	return m.addEventHandler(func(i cache.SharedIndexInformer) (cache.ResourceEventHandlerRegistration, error) {
+		return i.AddEventHandlerWithOptions(handler, options)
+	})
+}
+
+func (m *multiNamespaceInformer) addEventHandler(add func(cache.SharedIndexInformer) (cache.ResourceEventHandlerRegistration, error)) (cache.ResourceEventHandlerRegistration, error) {
+	regs := make(multiRegistration, 0, len(m.informers))
+	for _, informer := range m.informers {
+		reg, err := add(informer)
+		if err != nil {
+			return nil, err
+		}
+		regs = append(regs, reg)
+	}
+	return regs, nil
+}
+
+func (m *multiNamespaceInformer) RemoveEventHandler(handle cache.ResourceEventHandlerRegistration) error {
+	regs, ok := handle.(multiRegistration)
+	if !ok || len(regs) != len(m.informers) {
+		return errors.New("handler was not registered on this informer")
+	}
+	var errs []error
+	for i, informer := range m.informers {
+		errs = append(errs, informer.RemoveEventHandler(regs[i]))
+	}
+	return errors.Join(errs...)
+}
+
+func (m *multiNamespaceInformer) GetStore() cache.Store {
+	return m.GetIndexer()
+}
+
+func (m *multiNamespaceInformer) GetIndexer() cache.Indexer {
+	indexers := make(map[string]cache.Indexer, len(m.byNamespace))
+	for ns, informer := range m.byNamespace {
+		indexers[ns] = informer.GetIndexer()
+	}
+	return multiNamespaceIndexer(indexers)
+}
+
+// GetController returns the controller of the first namespace only; the
+// watcher never uses it.
+func (m *multiNamespaceInformer) GetController() cache.Controller {
+	return m.informers[0].GetController()
+}
+
+func (m *multiNamespaceInformer) Run(stopCh <-chan struct{}) {
+	var wg sync.WaitGroup
+	for _, informer := range m.informers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			informer.Run(stopCh)
+		}()
+	}
+	wg.Wait()
+}
+
+func (m *multiNamespaceInformer) RunWithContext(ctx context.Context) {
+	m.Run(ctx.Done())
+}
+
+func (m *multiNamespaceInformer) HasSynced() bool {
+	for _, informer := range m.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// LastSyncResourceVersion joins the versions of every namespace, so it
+// changes whenever any of them does.
+func (m *multiNamespaceInformer) LastSyncResourceVersion() string {
+	versions := make([]string, 0, len(m.informers))
+	for _, informer := range m.informers {
+		versions = append(versions, informer.LastSyncResourceVersion())
+	}
+	return strings.Join(versions, ",")
+}
+
+func (m *multiNamespaceInformer) SetWatchErrorHandler(handler cache.WatchErrorHandler) error {
+	return m.each(func(i cache.SharedIndexInformer) error { return i.SetWatchErrorHandler(handler) })
+}
+
+func (m *multiNamespaceInformer) SetWatchErrorHandlerWithContext(handler cache.WatchErrorHandlerWithContext) error {
+	return m.each(func(i cache.SharedIndexInformer) error { return i.SetWatchErrorHandlerWithContext(handler) })
+}
+
+func (m *multiNamespaceInformer) SetTransform(handler cache.TransformFunc) error {
+	return m.each(func(i cache.SharedIndexInformer) error { return i.SetTransform(handler) })
+}
+
+func (m *multiNamespaceInformer) AddIndexers(indexers cache.Indexers) error {
+	return m.each(func(i cache.SharedIndexInformer) error { return i.AddIndexers(indexers) })
+}
+
+func (m *multiNamespaceInformer) IsStopped() bool {
+	for _, informer := range m.informers {
+		if !informer.IsStopped() {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *multiNamespaceInformer) each(fn func(cache.SharedIndexInformer) error) error {
+	for _, informer := range m.informers {
+		if err := fn(informer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// multiNamespaceIndexer reads across the indexers of every namespace, keyed
+// by namespace. Lookups by key or object go to the owning namespace, index
+// queries and listings are concatenated. Writes belong to the informers, so
+// only the per-object ones are routed and Replace and Resync are refused.
+type multiNamespaceIndexer map[string]cache.Indexer
+
+var _ cache.Indexer = multiNamespaceIndexer(nil)
+
+func (m multiNamespaceIndexer) forObject(obj any) (cache.Indexer, error) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	indexer, ok := m[accessor.GetNamespace()]
+	if !ok {
+		return nil, fmt.Errorf("namespace %q is not watched", accessor.GetNamespace())
+	}
+	return indexer, nil
+}
+
+func (m multiNamespaceIndexer) Add(obj any) error {
+	indexer, err := m.forObject(obj)
+	if err != nil {
+		return err
+	}
+	return indexer.Add(obj)
+}
+
+func (m multiNamespaceIndexer) Update(obj any) error {
+	indexer, err := m.forObject(obj)
+	if err != nil {
+		return err
+	}
+	return indexer.Update(obj)
+}
+
+func (m multiNamespaceIndexer) Delete(obj any) error {
+	indexer, err := m.forObject(obj)
+	if err != nil {
+		return err
+	}
+	return indexer.Delete(obj)
+}
+
+func (m multiNamespaceIndexer) List() []any {
+	var objs []any
+	for _, indexer := range m {
+		objs = append(objs, indexer.List()...)
+	}
+	return objs
+}
+
+func (m multiNamespaceIndexer) ListKeys() []string {
+	var keys []string
+	for _, indexer := range m {
+		keys = append(keys, indexer.ListKeys()...)
+	}
+	return keys
+}
+
+func (m multiNamespaceIndexer) Get(obj any) (any, bool, error) {
+	indexer, err := m.forObject(obj)
+	if err != nil {
+		return nil, false, nil
+	}
+	return indexer.Get(obj)
+}
+
+func (m multiNamespaceIndexer) GetByKey(key string) (any, bool, error) {
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	indexer, ok := m[namespace]
+	if !ok {
+		return nil, false, nil
+	}
+	return indexer.GetByKey(key)
+}
+
+func (m multiNamespaceIndexer) Replace([]any, string) error {
+	return errors.New("replace is not supported across namespaces")
+}
+
+func (m multiNamespaceIndexer) Resync() error {
+	return errors.New("resync is not supported across namespaces")
+}
+
+func (m multiNamespaceIndexer) Index(indexName string, obj any) ([]any, error) {
+	var objs []any
+	for _, indexer := range m {
+		found, err := indexer.Index(indexName, obj)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, found...)
+	}
+	return objs, nil
+}
+
+func (m multiNamespaceIndexer) IndexKeys(indexName, indexedValue string) ([]string, error) {
+	var keys []string
+	for _, indexer := range m {
+		found, err := indexer.IndexKeys(indexName, indexedValue)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, found...)
+	}
+	return keys, nil
+}
+
+func (m multiNamespaceIndexer) ListIndexFuncValues(indexName string) []string {
+	var values []string
+	for _, indexer := range m {
+		values = append(values, indexer.ListIndexFuncValues(indexName)...)
+	}
+	return dedupe(values)
+}
+
+func (m multiNamespaceIndexer) ByIndex(indexName, indexedValue string) ([]any, error) {
+	var objs []any
+	for _, indexer := range m {
+		found, err := indexer.ByIndex(indexName, indexedValue)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, found...)
+	}
+	return objs, nil
+}
+
+// GetIndexers returns the indexers of any namespace; AddIndexers keeps them
+// the same everywhere.
+func (m multiNamespaceIndexer) GetIndexers() cache.Indexers {
+	for _, indexer := range m {
+		return indexer.GetIndexers()
+	}
+	return cache.Indexers{}
+}
+
+func (m multiNamespaceIndexer) AddIndexers(newIndexers cache.Indexers) error {
+	for _, indexer := range m {
+		if err := indexer.AddIndexers(newIndexers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
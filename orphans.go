@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// orphanReport is the response of GET /configmaps/orphans.
+type orphanReport struct {
+	ConfigMaps []objectRef `json:"configMaps"`
+	// BatchReferencesCounted is false when Jobs and CronJobs are not watched,
+	// so ConfigMaps used only by them are reported as orphans.
+	BatchReferencesCounted bool   `json:"batchReferencesCounted"`
+	Note                   string `json:"note,omitempty"`
+}
+
+// orphanConfigMaps returns every cached ConfigMap that no Pod references,
+// nor any Job or CronJob when those are watched. ConfigMaps in ignored
+// namespaces or named in OrphanIgnoreNames are skipped.
+func (c *Controller) orphanConfigMaps() ([]objectRef, error) {
+	orphans := []objectRef{}
+	for _, obj := range c.configMapInformer.GetStore().List() {
+		cm, ok := obj.(*v1.ConfigMap)
+		if !ok || c.ignoredNamespaces[cm.Namespace] || slices.Contains(c.opts.OrphanIgnoreNames, cm.Name) {
+			continue
+		}
+
+		key := cm.Namespace + "/" + cm.Name
+		podKeys, err := c.podKeysReferencingConfigMap(key)
+		if err != nil {
+			return nil, fmt.Errorf("fetching pods for %s from index: %w", key, err)
+		}
+		if len(podKeys) > 0 {
+			continue
+		}
+		if c.jobInformer != nil {
+			workloads, err := c.batchWorkloadsForConfigMap(key)
+			if err != nil {
+				return nil, err
+			}
+			if len(workloads) > 0 {
+				continue
+			}
+		}
+
+		orphans = append(orphans, objectRef{Namespace: cm.Namespace, Name: cm.Name})
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].Namespace != orphans[j].Namespace {
+			return orphans[i].Namespace < orphans[j].Namespace
+		}
+		return orphans[i].Name < orphans[j].Name
+	})
+	return orphans, nil
+}
+
+func (c *Controller) handleOrphanConfigMaps(w http.ResponseWriter, r *http.Request) {
+	orphans, err := c.orphanConfigMaps()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	report := orphanReport{ConfigMaps: orphans, BatchReferencesCounted: c.jobInformer != nil}
+	if !report.BatchReferencesCounted {
+		report.Note = "Jobs and CronJobs are not watched; ConfigMaps referenced only by them are listed. Enable -watch-batch to count them."
+	}
+	writeJSON(w, report)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// deploymentForPod walks Pod→ReplicaSet→Deployment. It returns false when the
+// pod is not owned by a ReplicaSet belonging to a Deployment.
+func (c *Controller) deploymentForPod(ctx context.Context, pod *v1.Pod) (workloadRef, bool, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "ReplicaSet" {
+		return workloadRef{}, false, nil
+	}
+
+	key := pod.Namespace + "/" + owner.Name
+	c.replicaSetOwnersMu.Lock()
+	ref, cached := c.replicaSetOwners[key]
+	c.replicaSetOwnersMu.Unlock()
+	if cached {
+		return ref, true, nil
+	}
+
+	rs, err := c.getReplicaSet(ctx, pod.Namespace, owner.Name)
+	if err != nil {
+		return workloadRef{}, false, err
+	}
+	rsOwner := metav1.GetControllerOf(rs)
+	if rsOwner == nil || rsOwner.Kind != "Deployment" {
+		return workloadRef{}, false, nil
+	}
+
+	ref = workloadRef{Kind: "Deployment", Namespace: pod.Namespace, Name: rsOwner.Name}
+	c.replicaSetOwnersMu.Lock()
+	c.replicaSetOwners[key] = ref
+	c.replicaSetOwnersMu.Unlock()
+	return ref, true, nil
+}
+
+// getReplicaSet returns a ReplicaSet from the informer cache, falling back to
+// the API server for ReplicaSets created after the last watch event.
+func (c *Controller) getReplicaSet(ctx context.Context, namespace, name string) (*appsv1.ReplicaSet, error) {
+	if c.replicaSetInformer != nil {
+		obj, exists, err := c.replicaSetInformer.GetIndexer().GetByKey(namespace + "/" + name)
+		if err != nil {
+			return nil, err
+		}
+		if rs, ok := obj.(*appsv1.ReplicaSet); exists && ok {
+			return rs, nil
+		}
+	}
+	return c.clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+// getDeployment returns a Deployment from the informer cache, falling back to
+// the API server when it is not cached.
+func (c *Controller) getDeployment(ctx context.Context, namespace, name string) (*appsv1.Deployment, error) {
+	if c.deploymentInformer != nil {
+		obj, exists, err := c.deploymentInformer.GetIndexer().GetByKey(namespace + "/" + name)
+		if err != nil {
+			return nil, err
+		}
+		if d, ok := obj.(*appsv1.Deployment); exists && ok {
+			return d, nil
+		}
+	}
+	return c.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (c *Controller) onReplicaSetDelete(obj any) {
+	var rs *appsv1.ReplicaSet
+	switch obj := obj.(type) {
+	case *appsv1.ReplicaSet:
+		rs = obj
+	case cache.DeletedFinalStateUnknown:
+		rs, _ = obj.Obj.(*appsv1.ReplicaSet)
+	}
+	if rs == nil {
+		warnUnexpectedObject("ReplicaSet", "delete", obj)
+		return
+	}
+
+	c.replicaSetOwnersMu.Lock()
+	delete(c.replicaSetOwners, rs.Namespace+"/"+rs.Name)
+	c.replicaSetOwnersMu.Unlock()
+}
+
+// configMapOwnerIgnored reports whether cm is managed by another controller
+// that -ignore-owned-configmaps or -ignore-owner-kinds leaves alone, and
+// returns the kind of the owner that decided it.
+func (c *Controller) configMapOwnerIgnored(cm *v1.ConfigMap) (kind string, ignored bool) {
+	for _, owner := range cm.OwnerReferences {
+		if c.opts.IgnoreOwnedConfigMaps || c.ignoredOwnerKinds[owner.Kind] {
+			return owner.Kind, true
+		}
+	}
+	return "", false
+}
+
+// topLevelOwner returns the workload at the top of pod's controller chain:
+// the Deployment owning its ReplicaSet, or else its controller. A pod
+// without a controller is returned itself, and a ReplicaSet whose Deployment
+// cannot be looked up stands in for it.
+func (c *Controller) topLevelOwner(ctx context.Context, pod *v1.Pod) workloadRef {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return workloadRef{Kind: "Pod", Namespace: pod.Namespace, Name: pod.Name}
+	}
+	if owner.Kind == "ReplicaSet" {
+		ref, ok, err := c.deploymentForPod(ctx, pod)
+		if err != nil {
+			loggerFrom(ctx).Debug("Error resolving Deployment of Pod", "kind", "Pod", "namespace", pod.Namespace, "name", pod.Name, "err", err)
+		}
+		if ok {
+			return ref
+		}
+	}
+	return workloadRef{Kind: owner.Kind, Namespace: pod.Namespace, Name: owner.Name}
+}
@@ -0,0 +1,350 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: referencegraph/v1/referencegraph.proto
+
+package referencegraphv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// ObjectRef identifies a namespaced object.
+type ObjectRef struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ObjectRef) Reset() {
+	*x = ObjectRef{}
+	mi := &file_referencegraph_v1_referencegraph_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ObjectRef) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ObjectRef) ProtoMessage() {}
+
+func (x *ObjectRef) ProtoReflect() protoreflect.Message {
+	mi := &file_referencegraph_v1_referencegraph_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ObjectRef.ProtoReflect.Descriptor instead.
+func (*ObjectRef) Descriptor() ([]byte, []int) {
+	return file_referencegraph_v1_referencegraph_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ObjectRef) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *ObjectRef) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type ListPodsForConfigMapRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPodsForConfigMapRequest) Reset() {
+	*x = ListPodsForConfigMapRequest{}
+	mi := &file_referencegraph_v1_referencegraph_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPodsForConfigMapRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPodsForConfigMapRequest) ProtoMessage() {}
+
+func (x *ListPodsForConfigMapRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_referencegraph_v1_referencegraph_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPodsForConfigMapRequest.ProtoReflect.Descriptor instead.
+func (*ListPodsForConfigMapRequest) Descriptor() ([]byte, []int) {
+	return file_referencegraph_v1_referencegraph_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListPodsForConfigMapRequest) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *ListPodsForConfigMapRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type ListPodsForConfigMapResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Pods sorted by namespace and name.
+	Pods          []*ObjectRef `protobuf:"bytes,1,rep,name=pods,proto3" json:"pods,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListPodsForConfigMapResponse) Reset() {
+	*x = ListPodsForConfigMapResponse{}
+	mi := &file_referencegraph_v1_referencegraph_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListPodsForConfigMapResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPodsForConfigMapResponse) ProtoMessage() {}
+
+func (x *ListPodsForConfigMapResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_referencegraph_v1_referencegraph_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPodsForConfigMapResponse.ProtoReflect.Descriptor instead.
+func (*ListPodsForConfigMapResponse) Descriptor() ([]byte, []int) {
+	return file_referencegraph_v1_referencegraph_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListPodsForConfigMapResponse) GetPods() []*ObjectRef {
+	if x != nil {
+		return x.Pods
+	}
+	return nil
+}
+
+type ListConfigMapsForPodRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConfigMapsForPodRequest) Reset() {
+	*x = ListConfigMapsForPodRequest{}
+	mi := &file_referencegraph_v1_referencegraph_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConfigMapsForPodRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConfigMapsForPodRequest) ProtoMessage() {}
+
+func (x *ListConfigMapsForPodRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_referencegraph_v1_referencegraph_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConfigMapsForPodRequest.ProtoReflect.Descriptor instead.
+func (*ListConfigMapsForPodRequest) Descriptor() ([]byte, []int) {
+	return file_referencegraph_v1_referencegraph_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListConfigMapsForPodRequest) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *ListConfigMapsForPodRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type ListConfigMapsForPodResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ConfigMaps in the order the Pod spec references them.
+	ConfigMaps    []*ObjectRef `protobuf:"bytes,1,rep,name=config_maps,json=configMaps,proto3" json:"config_maps,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListConfigMapsForPodResponse) Reset() {
+	*x = ListConfigMapsForPodResponse{}
+	mi := &file_referencegraph_v1_referencegraph_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListConfigMapsForPodResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListConfigMapsForPodResponse) ProtoMessage() {}
+
+func (x *ListConfigMapsForPodResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_referencegraph_v1_referencegraph_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListConfigMapsForPodResponse.ProtoReflect.Descriptor instead.
+func (*ListConfigMapsForPodResponse) Descriptor() ([]byte, []int) {
+	return file_referencegraph_v1_referencegraph_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListConfigMapsForPodResponse) GetConfigMaps() []*ObjectRef {
+	if x != nil {
+		return x.ConfigMaps
+	}
+	return nil
+}
+
+var File_referencegraph_v1_referencegraph_proto protoreflect.FileDescriptor
+
+const file_referencegraph_v1_referencegraph_proto_rawDesc = "" +
+	"\n" +
+	"&referencegraph/v1/referencegraph.proto\x12&kubeconfigmapwatcher.referencegraph.v1\"=\n" +
+	"\tObjectRef\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"O\n" +
+	"\x1bListPodsForConfigMapRequest\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"e\n" +
+	"\x1cListPodsForConfigMapResponse\x12E\n" +
+	"\x04pods\x18\x01 \x03(\v21.kubeconfigmapwatcher.referencegraph.v1.ObjectRefR\x04pods\"O\n" +
+	"\x1bListConfigMapsForPodRequest\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"r\n" +
+	"\x1cListConfigMapsForPodResponse\x12R\n" +
+	"\vconfig_maps\x18\x01 \x03(\v21.kubeconfigmapwatcher.referencegraph.v1.ObjectRefR\n" +
+	"configMaps2\xd8\x02\n" +
+	"\x0eReferenceGraph\x12\xa1\x01\n" +
+	"\x14ListPodsForConfigMap\x12C.kubeconfigmapwatcher.referencegraph.v1.ListPodsForConfigMapRequest\x1aD.kubeconfigmapwatcher.referencegraph.v1.ListPodsForConfigMapResponse\x12\xa1\x01\n" +
+	"\x14ListConfigMapsForPod\x12C.kubeconfigmapwatcher.referencegraph.v1.ListConfigMapsForPodRequest\x1aD.kubeconfigmapwatcher.referencegraph.v1.ListConfigMapsForPodResponseBUZSgithub.com/prasad89/kube-configmap-watcher/proto/referencegraph/v1;referencegraphv1b\x06proto3"
+
+var (
+	file_referencegraph_v1_referencegraph_proto_rawDescOnce sync.Once
+	file_referencegraph_v1_referencegraph_proto_rawDescData []byte
+)
+
+func file_referencegraph_v1_referencegraph_proto_rawDescGZIP() []byte {
+	file_referencegraph_v1_referencegraph_proto_rawDescOnce.Do(func() {
+		file_referencegraph_v1_referencegraph_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_referencegraph_v1_referencegraph_proto_rawDesc), len(file_referencegraph_v1_referencegraph_proto_rawDesc)))
+	})
+	return file_referencegraph_v1_referencegraph_proto_rawDescData
+}
+
+var file_referencegraph_v1_referencegraph_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_referencegraph_v1_referencegraph_proto_goTypes = []any{
+	(*ObjectRef)(nil),                    // 0: kubeconfigmapwatcher.referencegraph.v1.ObjectRef
+	(*ListPodsForConfigMapRequest)(nil),  // 1: kubeconfigmapwatcher.referencegraph.v1.ListPodsForConfigMapRequest
+	(*ListPodsForConfigMapResponse)(nil), // 2: kubeconfigmapwatcher.referencegraph.v1.ListPodsForConfigMapResponse
+	(*ListConfigMapsForPodRequest)(nil),  // 3: kubeconfigmapwatcher.referencegraph.v1.ListConfigMapsForPodRequest
+	(*ListConfigMapsForPodResponse)(nil), // 4: kubeconfigmapwatcher.referencegraph.v1.ListConfigMapsForPodResponse
+}
+var file_referencegraph_v1_referencegraph_proto_depIdxs = []int32{
+	0, // 0: kubeconfigmapwatcher.referencegraph.v1.ListPodsForConfigMapResponse.pods:type_name -> kubeconfigmapwatcher.referencegraph.v1.ObjectRef
+	0, // 1: kubeconfigmapwatcher.referencegraph.v1.ListConfigMapsForPodResponse.config_maps:type_name -> kubeconfigmapwatcher.referencegraph.v1.ObjectRef
+	1, // 2: kubeconfigmapwatcher.referencegraph.v1.ReferenceGraph.ListPodsForConfigMap:input_type -> kubeconfigmapwatcher.referencegraph.v1.ListPodsForConfigMapRequest
+	3, // 3: kubeconfigmapwatcher.referencegraph.v1.ReferenceGraph.ListConfigMapsForPod:input_type -> kubeconfigmapwatcher.referencegraph.v1.ListConfigMapsForPodRequest
+	2, // 4: kubeconfigmapwatcher.referencegraph.v1.ReferenceGraph.ListPodsForConfigMap:output_type -> kubeconfigmapwatcher.referencegraph.v1.ListPodsForConfigMapResponse
+	4, // 5: kubeconfigmapwatcher.referencegraph.v1.ReferenceGraph.ListConfigMapsForPod:output_type -> kubeconfigmapwatcher.referencegraph.v1.ListConfigMapsForPodResponse
+	4, // [4:6] is the sub-list for method output_type
+	2, // [2:4] is the sub-list for method input_type
+	2, // [2:2] is the sub-list for extension type_name
+	2, // [2:2] is the sub-list for extension extendee
+	0, // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_referencegraph_v1_referencegraph_proto_init() }
+func file_referencegraph_v1_referencegraph_proto_init() {
+	if File_referencegraph_v1_referencegraph_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_referencegraph_v1_referencegraph_proto_rawDesc), len(file_referencegraph_v1_referencegraph_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_referencegraph_v1_referencegraph_proto_goTypes,
+		DependencyIndexes: file_referencegraph_v1_referencegraph_proto_depIdxs,
+		MessageInfos:      file_referencegraph_v1_referencegraph_proto_msgTypes,
+	}.Build()
+	File_referencegraph_v1_referencegraph_proto = out.File
+	file_referencegraph_v1_referencegraph_proto_goTypes = nil
+	file_referencegraph_v1_referencegraph_proto_depIdxs = nil
+}
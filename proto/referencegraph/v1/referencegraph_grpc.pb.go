@@ -0,0 +1,175 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: referencegraph/v1/referencegraph.proto
+
+package referencegraphv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ReferenceGraph_ListPodsForConfigMap_FullMethodName = "/kubeconfigmapwatcher.referencegraph.v1.ReferenceGraph/ListPodsForConfigMap"
+	ReferenceGraph_ListConfigMapsForPod_FullMethodName = "/kubeconfigmapwatcher.referencegraph.v1.ReferenceGraph/ListConfigMapsForPod"
+)
+
+// ReferenceGraphClient is the client API for ReferenceGraph service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ReferenceGraph answers which Pods reference which ConfigMaps from the
+// watcher's informer caches. Every RPC fails with UNAVAILABLE until the
+// caches have synced.
+type ReferenceGraphClient interface {
+	// ListPodsForConfigMap returns the Pods referencing a ConfigMap, or
+	// NOT_FOUND if the ConfigMap is not cached.
+	ListPodsForConfigMap(ctx context.Context, in *ListPodsForConfigMapRequest, opts ...grpc.CallOption) (*ListPodsForConfigMapResponse, error)
+	// ListConfigMapsForPod returns the ConfigMaps a Pod references, or
+	// NOT_FOUND if the Pod is not cached.
+	ListConfigMapsForPod(ctx context.Context, in *ListConfigMapsForPodRequest, opts ...grpc.CallOption) (*ListConfigMapsForPodResponse, error)
+}
+
+type referenceGraphClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewReferenceGraphClient(cc grpc.ClientConnInterface) ReferenceGraphClient {
+	return &referenceGraphClient{cc}
+}
+
+func (c *referenceGraphClient) ListPodsForConfigMap(ctx context.Context, in *ListPodsForConfigMapRequest, opts ...grpc.CallOption) (*ListPodsForConfigMapResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListPodsForConfigMapResponse)
+	err := c.cc.Invoke(ctx, ReferenceGraph_ListPodsForConfigMap_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *referenceGraphClient) ListConfigMapsForPod(ctx context.Context, in *ListConfigMapsForPodRequest, opts ...grpc.CallOption) (*ListConfigMapsForPodResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListConfigMapsForPodResponse)
+	err := c.cc.Invoke(ctx, ReferenceGraph_ListConfigMapsForPod_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ReferenceGraphServer is the server API for ReferenceGraph service.
+// All implementations must embed UnimplementedReferenceGraphServer
+// for forward compatibility.
+//
+// ReferenceGraph answers which Pods reference which ConfigMaps from the
+// watcher's informer caches. Every RPC fails with UNAVAILABLE until the
+// caches have synced.
+type ReferenceGraphServer interface {
+	// ListPodsForConfigMap returns the Pods referencing a ConfigMap, or
+	// NOT_FOUND if the ConfigMap is not cached.
+	ListPodsForConfigMap(context.Context, *ListPodsForConfigMapRequest) (*ListPodsForConfigMapResponse, error)
+	// ListConfigMapsForPod returns the ConfigMaps a Pod references, or
+	// NOT_FOUND if the Pod is not cached.
+	ListConfigMapsForPod(context.Context, *ListConfigMapsForPodRequest) (*ListConfigMapsForPodResponse, error)
+	mustEmbedUnimplementedReferenceGraphServer()
+}
+
+// UnimplementedReferenceGraphServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedReferenceGraphServer struct{}
+
+func (UnimplementedReferenceGraphServer) ListPodsForConfigMap(context.Context, *ListPodsForConfigMapRequest) (*ListPodsForConfigMapResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPodsForConfigMap not implemented")
+}
+func (UnimplementedReferenceGraphServer) ListConfigMapsForPod(context.Context, *ListConfigMapsForPodRequest) (*ListConfigMapsForPodResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListConfigMapsForPod not implemented")
+}
+func (UnimplementedReferenceGraphServer) mustEmbedUnimplementedReferenceGraphServer() {}
+func (UnimplementedReferenceGraphServer) testEmbeddedByValue()                        {}
+
+// UnsafeReferenceGraphServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ReferenceGraphServer will
+// result in compilation errors.
+type UnsafeReferenceGraphServer interface {
+	mustEmbedUnimplementedReferenceGraphServer()
+}
+
+func RegisterReferenceGraphServer(s grpc.ServiceRegistrar, srv ReferenceGraphServer) {
+	// If the following call pancis, it indicates UnimplementedReferenceGraphServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ReferenceGraph_ServiceDesc, srv)
+}
+
+func _ReferenceGraph_ListPodsForConfigMap_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPodsForConfigMapRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReferenceGraphServer).ListPodsForConfigMap(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReferenceGraph_ListPodsForConfigMap_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReferenceGraphServer).ListPodsForConfigMap(ctx, req.(*ListPodsForConfigMapRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ReferenceGraph_ListConfigMapsForPod_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListConfigMapsForPodRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReferenceGraphServer).ListConfigMapsForPod(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReferenceGraph_ListConfigMapsForPod_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReferenceGraphServer).ListConfigMapsForPod(ctx, req.(*ListConfigMapsForPodRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ReferenceGraph_ServiceDesc is the grpc.ServiceDesc for ReferenceGraph service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ReferenceGraph_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "kubeconfigmapwatcher.referencegraph.v1.ReferenceGraph",
+	HandlerType: (*ReferenceGraphServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListPodsForConfigMap",
+			Handler:    _ReferenceGraph_ListPodsForConfigMap_Handler,
+		},
+		{
+			MethodName: "ListConfigMapsForPod",
+			Handler:    _ReferenceGraph_ListConfigMapsForPod_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "referencegraph/v1/referencegraph.proto",
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// allowRestart reports whether the token bucket of namespace permits another
+// restart now, consuming a token if so.
+func (c *Controller) allowRestart(namespace string) bool {
+	if c.opts.MaxRestartsPerMinute <= 0 {
+		return true
+	}
+
+	c.restartLimitersMu.Lock()
+	limiter := c.restartLimiters[namespace]
+	if limiter == nil {
+		limiter = rate.NewLimiter(rate.Every(c.restartInterval()), c.opts.MaxRestartsPerMinute)
+		c.restartLimiters[namespace] = limiter
+	}
+	c.restartLimitersMu.Unlock()
+
+	return limiter.Allow()
+}
+
+// inRestartCooldown reports whether ref was restarted less than
+// RestartCooldown ago, in which case its rollout is still picking up changes
+// and another restart would only roll it again.
+func (c *Controller) inRestartCooldown(ref workloadRef) bool {
+	return c.restartCooldownRemaining(ref) > 0
+}
+
+// restartCooldownRemaining returns how long the cooldown of ref still runs,
+// or 0 when it is not in one.
+func (c *Controller) restartCooldownRemaining(ref workloadRef) time.Duration {
+	if c.opts.RestartCooldown <= 0 {
+		return 0
+	}
+
+	c.restartCooldownsMu.Lock()
+	defer c.restartCooldownsMu.Unlock()
+	at, ok := c.restartCooldowns[ref]
+	if !ok {
+		return 0
+	}
+	return max(c.opts.RestartCooldown-time.Since(at), 0)
+}
+
+// recordRestartCooldown starts the cooldown of ref, dropping expired entries.
+func (c *Controller) recordRestartCooldown(ref workloadRef) {
+	if c.opts.RestartCooldown <= 0 {
+		return
+	}
+
+	c.restartCooldownsMu.Lock()
+	defer c.restartCooldownsMu.Unlock()
+	now := time.Now()
+	for r, at := range c.restartCooldowns {
+		if now.Sub(at) >= c.opts.RestartCooldown {
+			delete(c.restartCooldowns, r)
+		}
+	}
+	c.restartCooldowns[ref] = now
+}
+
+// restartInterval is the time it takes a namespace's bucket to regain one
+// token.
+func (c *Controller) restartInterval() time.Duration {
+	return time.Minute / time.Duration(c.opts.MaxRestartsPerMinute)
+}
+
+// restartsDeferredError reports restarts held back by the per-namespace rate
+// limit or a workload's cooldown, or still in progress. The ConfigMap is
+// requeued after RetryAfter without counting against maxRetries.
+type restartsDeferredError struct {
+	Deferred   int
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *restartsDeferredError) Error() string {
+	return fmt.Sprintf("%d workload restarts deferred: %s", e.Deferred, e.Reason)
+}
+
+// earliestRetry returns whichever of a and b is retried first; a may be nil.
+func earliestRetry(a, b *restartsDeferredError) *restartsDeferredError {
+	if a == nil || b.RetryAfter < a.RetryAfter {
+		return b
+	}
+	return a
+}
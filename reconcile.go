@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/runtime"
+)
+
+// maxRetries is the number of times a ConfigMap key is retried before it is
+// dropped from the queue.
+const maxRetries = 5
+
+// recordChangedKeys merges keys into the pending changes of a ConfigMap.
+func (c *Controller) recordChangedKeys(key string, keys []string) {
+	c.changedKeysMu.Lock()
+	defer c.changedKeysMu.Unlock()
+
+	set := c.changedKeys[key]
+	if set == nil {
+		set = make(map[string]struct{})
+		c.changedKeys[key] = set
+	}
+	for _, k := range keys {
+		set[k] = struct{}{}
+	}
+}
+
+// reconcileID returns the correlation ID of the pending reconcile of a
+// ConfigMap, creating one for the first update since the last reconcile.
+func (c *Controller) reconcileID(key string) string {
+	c.reconcileIDsMu.Lock()
+	defer c.reconcileIDsMu.Unlock()
+
+	id, ok := c.reconcileIDs[key]
+	if !ok {
+		id = newReconcileID()
+		c.reconcileIDs[key] = id
+	}
+	return id
+}
+
+// takeReconcileID returns and clears the correlation ID of a ConfigMap,
+// creating one if no update recorded it.
+func (c *Controller) takeReconcileID(key string) string {
+	c.reconcileIDsMu.Lock()
+	id, ok := c.reconcileIDs[key]
+	delete(c.reconcileIDs, key)
+	c.reconcileIDsMu.Unlock()
+
+	if !ok {
+		id = newReconcileID()
+	}
+	return id
+}
+
+// restoreReconcileID keeps the correlation ID of a requeued ConfigMap so its
+// retries log under the same ID, unless a newer update already created one.
+func (c *Controller) restoreReconcileID(key, id string) {
+	c.reconcileIDsMu.Lock()
+	defer c.reconcileIDsMu.Unlock()
+	if _, ok := c.reconcileIDs[key]; !ok {
+		c.reconcileIDs[key] = id
+	}
+}
+
+// newReconcileID returns a short random correlation ID.
+func newReconcileID() string {
+	return fmt.Sprintf("%08x", rand.Uint32())
+}
+
+// takeChangedKeys returns and clears the pending changes of a ConfigMap.
+func (c *Controller) takeChangedKeys(key string) []string {
+	c.changedKeysMu.Lock()
+	set := c.changedKeys[key]
+	delete(c.changedKeys, key)
+	c.changedKeysMu.Unlock()
+
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// drainQueue shuts the queue down and waits up to timeout for the workers in
+// wg to process the remaining items. On timeout it calls cancel to abort
+// in-flight API calls and waits for the workers to return. It reports whether
+// the queue drained.
+func (c *Controller) drainQueue(wg *sync.WaitGroup, timeout time.Duration, cancel context.CancelFunc) bool {
+	slog.Info("Draining work queue", "pending", c.queue.Len(), "timeout", timeout)
+	c.queue.ShutDown()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		slog.Info("Work queue drained")
+		return true
+	case <-time.After(timeout):
+		cancel()
+		<-done
+		return false
+	}
+}
+
+func (c *Controller) runWorker(ctx context.Context) {
+	for c.processNextItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	changed := c.takeChangedKeys(key)
+	resyncOnly := c.takeResyncOnly(key)
+	id := c.takeReconcileID(key)
+	// Every line logged for this reconcile carries its correlation ID
+	ctx = withLogger(ctx, slog.With("reconcileID", id))
+	ctx, span := tracer.Start(ctx, "reconcileConfigMap", trace.WithAttributes(
+		attribute.String("configmap.key", key),
+		attribute.String("reconcile.id", id),
+		attribute.Int("configmap.requeues", c.queue.NumRequeues(key)),
+	))
+	start := time.Now()
+	err := c.reconcileConfigMap(ctx, key, id, changed, resyncOnly)
+	reconcileDuration.WithLabelValues(reconcileResult(err)).Observe(time.Since(start).Seconds())
+	endSpan(span, err)
+	c.handleErr(ctx, err, key, id, changed, resyncOnly)
+	return true
+}
+
+// reconcileResult is the result label of reconcileDuration. Deferred
+// restarts count as success since the reconcile itself completed.
+func reconcileResult(err error) string {
+	var deferred *restartsDeferredError
+	if err == nil || errors.As(err, &deferred) {
+		return "success"
+	}
+	return "error"
+}
+
+func (c *Controller) handleErr(ctx context.Context, err error, key, id string, changed []string, resyncOnly bool) {
+	if err == nil {
+		c.forget(key)
+		return
+	}
+
+	var deferred *restartsDeferredError
+	if errors.As(err, &deferred) {
+		c.recordChangedKeys(key, changed)
+		c.restoreReconcileID(key, id)
+		c.queue.AddAfter(key, deferred.RetryAfter)
+		return
+	}
+
+	if c.queue.NumRequeues(key) < maxRetries {
+		loggerFrom(ctx).Warn("Error reconciling ConfigMap, retrying", "key", key, "err", err)
+		c.recordChangedKeys(key, changed)
+		// Marked before the ID is restored, which would count as a
+		// pending update
+		if resyncOnly {
+			c.markResyncOnly(key)
+		}
+		c.restoreReconcileID(key, id)
+		c.queue.AddRateLimited(key)
+		return
+	}
+
+	c.forget(key)
+	runtime.HandleError(err)
+	loggerFrom(ctx).Error("Dropping ConfigMap out of the queue", "key", key, "retries", maxRetries, "err", err)
+}
+
+func (c *Controller) forget(key string) {
+	c.queue.Forget(key)
+	c.resetRestarted(key)
+	c.abandonRecreates(key)
+	c.replacedMu.Lock()
+	delete(c.replaced, key)
+	c.replacedMu.Unlock()
+}
+
+// resetRestarted clears the restart bookkeeping of a ConfigMap: the
+// workloads recorded as restarted, whether its update was notified and
+// whether its pending reconcile only reports.
+func (c *Controller) resetRestarted(key string) {
+	c.restartedMu.Lock()
+	delete(c.restarted, key)
+	c.restartedMu.Unlock()
+	c.notifiedMu.Lock()
+	delete(c.notified, key)
+	c.notifiedMu.Unlock()
+	c.resyncOnlyMu.Lock()
+	delete(c.resyncOnly, key)
+	c.resyncOnlyMu.Unlock()
+}
+
+// firstNotification reports whether the reconcile with correlation ID id is
+// the first pass of its update of the ConfigMap stored under key to send the
+// ReferencedPodsFound event and the webhook, and records that it did.
+// Retries keep the ID, so rate-limit deferrals, recreate polls and error
+// retries notify once.
+func (c *Controller) firstNotification(key, id string) bool {
+	c.notifiedMu.Lock()
+	defer c.notifiedMu.Unlock()
+	if c.notified[key] == id {
+		return false
+	}
+	c.notified[key] = id
+	return true
+}
+
+// markResyncOnly marks the pending reconcile of a ConfigMap as queued by a
+// resync alone, unless an update is already pending, so it reports without
+// restarting. An update arriving later clears the mark.
+func (c *Controller) markResyncOnly(key string) {
+	c.reconcileIDsMu.Lock()
+	_, pending := c.reconcileIDs[key]
+	c.reconcileIDsMu.Unlock()
+	if pending {
+		return
+	}
+	c.resyncOnlyMu.Lock()
+	c.resyncOnly[key] = true
+	c.resyncOnlyMu.Unlock()
+}
+
+// takeResyncOnly returns and clears the mark set by markResyncOnly.
+func (c *Controller) takeResyncOnly(key string) bool {
+	c.resyncOnlyMu.Lock()
+	defer c.resyncOnlyMu.Unlock()
+	resyncOnly := c.resyncOnly[key]
+	delete(c.resyncOnly, key)
+	return resyncOnly
+}
+
+// recordDeleted remembers the UID of a deleted ConfigMap for recordReplaced.
+func (c *Controller) recordDeleted(key string, uid types.UID) {
+	c.replacedMu.Lock()
+	defer c.replacedMu.Unlock()
+	c.deletedUIDs[key] = uid
+}
+
+// recordReplaced reports whether a ConfigMap added under key replaces one
+// deleted earlier, and if so marks it replaced until its reconcile succeeds.
+func (c *Controller) recordReplaced(key string, uid types.UID) bool {
+	c.replacedMu.Lock()
+	defer c.replacedMu.Unlock()
+	old, ok := c.deletedUIDs[key]
+	if !ok || old == uid {
+		return false
+	}
+	delete(c.deletedUIDs, key)
+	c.replaced[key] = true
+	return true
+}
+
+// configMapReplaced reports whether the ConfigMap stored under key was
+// replaced since its last successful reconcile.
+func (c *Controller) configMapReplaced(key string) bool {
+	c.replacedMu.Lock()
+	defer c.replacedMu.Unlock()
+	return c.replaced[key]
+}
+
+// reconcileConfigMap looks up the Pods referencing the ConfigMap stored under
+// key and performs the configured side effects. id is the correlation ID of
+// the update, kept across its retries. changed lists the data keys modified
+// since the last reconcile. A resyncOnly reconcile, queued by a resync with
+// no update pending, only logs the referencing Pods: it sends no event or
+// webhook and restarts nothing since the ConfigMap did not change.
+func (c *Controller) reconcileConfigMap(ctx context.Context, key, id string, changed []string, resyncOnly bool) error {
+	logger := loggerFrom(ctx)
+	obj, exists, err := c.configMapInformer.GetIndexer().GetByKey(key)
+	if err != nil {
+		return fmt.Errorf("fetching ConfigMap %s from store: %w", key, err)
+	}
+	if !exists {
+		logger.Debug("ConfigMap no longer exists, skipping", "key", key)
+		return nil
+	}
+	cm, ok := obj.(*v1.ConfigMap)
+	if !ok {
+		return nil
+	}
+	// The annotation, owners or watch list may have changed while the
+	// update was queued
+	if _, owned := c.configMapOwnerIgnored(cm); owned || configMapIgnored(cm) || !c.watchListAllows(key) {
+		logger.Debug("ConfigMap ignored, skipping", "key", key)
+		return nil
+	}
+
+	pods, err := c.podsReferencingConfigMap(key)
+	if err != nil {
+		return fmt.Errorf("fetching pods from index: %w", err)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("configmap.namespace", cm.Namespace),
+		attribute.String("configmap.name", cm.Name),
+		attribute.Int("configmap.referencing_pods", len(pods)),
+	)
+
+	// Without Pods there are no references to report
+	if !c.opts.ConfigMapOnly {
+		logger.Info("Found Pods using ConfigMap", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name, "count", len(pods))
+		topLevelOwner := func(pod *v1.Pod) workloadRef { return c.topLevelOwner(ctx, pod) }
+		c.logReferencingPods(ctx, pods, "ConfigMap", "configMap", key, topLevelOwner, func(pod *v1.Pod) []any {
+			var attrs []any
+			// Prefixes tell which environment variables come from this ConfigMap
+			if prefixes := c.envFromPrefixes(pod, cm.Name); len(prefixes) > 0 {
+				attrs = append(attrs, "envFromPrefixes", prefixes)
+			}
+			// subPath mounts only pick up the change after a restart
+			if c.mountsViaSubPath(pod, cm.Name) {
+				attrs = append(attrs, "subPath", true)
+			}
+			return attrs
+		})
+	}
+
+	if c.jobInformer != nil {
+		workloads, err := c.batchWorkloadsForConfigMap(key)
+		if err != nil {
+			return fmt.Errorf("fetching batch workloads from index: %w", err)
+		}
+		for _, ref := range workloads {
+			logger.Info("Batch workload references ConfigMap", "kind", ref.Kind, "namespace", ref.Namespace, "name", ref.Name, "configMap", key)
+		}
+	}
+
+	// Pods consuming a changed key or the whole ConfigMap. With the changed
+	// keys known, only they are affected by the change; otherwise every
+	// referencing Pod is
+	affected := pods
+	if len(changed) > 0 && !c.opts.ConfigMapOnly {
+		dependent, err := c.podsForConfigMapKeys(key, changed)
+		if err != nil {
+			return fmt.Errorf("fetching pods from key index: %w", err)
+		}
+		affected = make([]any, 0, len(dependent))
+		names := make([]string, 0, len(dependent))
+		for _, pod := range dependent {
+			affected = append(affected, pod)
+			names = append(names, pod.Namespace+"/"+pod.Name)
+		}
+		sort.Strings(names)
+		logged, more := c.truncatePodList(names)
+		logger.Info("Pods depending on changed keys", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name,
+			"changedKeys", changed, "count", len(names), "pods", logged, "more", more)
+	}
+
+	// A resync changed nothing, so it neither notifies nor restarts
+	if resyncOnly {
+		logger.Debug("Reconcile requested by resync, not notifying or restarting workloads", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+		span.SetAttributes(attribute.Bool("restart.triggered", false))
+		return nil
+	}
+
+	// Retries of an update, such as the polls of a recreate in progress,
+	// were already notified
+	if c.firstNotification(key, id) {
+		if !c.opts.ConfigMapOnly {
+			c.recorder.Eventf(cm, v1.EventTypeNormal, "ReferencedPodsFound", "ConfigMap is referenced by %d Pods", len(pods))
+		}
+		if c.opts.WebhookURL != "" {
+			payload := webhookPayload{
+				ConfigMap:       objectRef{Namespace: cm.Namespace, Name: cm.Name},
+				ChangedKeys:     changed,
+				ReferencingPods: podRefs(pods),
+				AffectedPods:    podRefs(affected),
+			}
+			if err := c.webhooks.notify(logger, c.opts.WebhookURL, payload); err != nil {
+				logger.Error("Error queuing webhook", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name, "err", err)
+			}
+		}
+	}
+
+	if c.opts.EnableRestart && configMapRestartDisabled(cm) {
+		logger.Info("Restarts disabled by ConfigMap annotation, skipping", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name,
+			"annotation", restartAnnotation)
+		span.SetAttributes(attribute.Bool("restart.triggered", false))
+		return nil
+	}
+	if c.opts.EnableRestart {
+		c.restartedMu.Lock()
+		done := c.restarted[key]
+		if done == nil {
+			done = make(map[workloadRef]bool)
+			c.restarted[key] = done
+		}
+		c.restartedMu.Unlock()
+
+		// Workloads consuming only unchanged keys keep running
+		if skipped := len(pods) - len(affected); skipped > 0 {
+			logger.Info("Not restarting Pods that only consume unchanged keys", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name,
+				"changedKeys", changed, "count", skipped)
+		}
+
+		before := len(done)
+		err := c.restartWorkloads(ctx, cm, affected, done)
+		span.SetAttributes(attribute.Bool("restart.triggered", len(done) > before))
+		return err
+	}
+	span.SetAttributes(attribute.Bool("restart.triggered", false))
+	return nil
+}
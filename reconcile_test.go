@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestReconcileConfigMap(t *testing.T) {
+	tests := []struct {
+		name       string
+		cm         func() *v1.ConfigMap
+		changed    []string
+		resyncOnly bool
+		want       []string
+	}{
+		{
+			name: "restarts consumers",
+			cm:   func() *v1.ConfigMap { return testConfigMap("app-config", map[string]string{"level": "info"}) },
+			want: []string{"deployments/env", "deployments/web"},
+		},
+		{
+			name:    "restarts consumers of changed keys only",
+			cm:      func() *v1.ConfigMap { return testConfigMap("app-config", map[string]string{"level": "info"}) },
+			changed: []string{"level"},
+			want:    []string{"deployments/env"},
+		},
+		{
+			name:       "resync only reports",
+			cm:         func() *v1.ConfigMap { return testConfigMap("app-config", map[string]string{"level": "info"}) },
+			resyncOnly: true,
+		},
+		{
+			name: "restarts disabled by ConfigMap annotation",
+			cm: func() *v1.ConfigMap {
+				cm := testConfigMap("app-config", map[string]string{"level": "info"})
+				cm.Annotations = map[string]string{restartAnnotation: "false"}
+				return cm
+			},
+		},
+		{
+			name: "ConfigMap ignored",
+			cm: func() *v1.ConfigMap {
+				cm := testConfigMap("app-config", map[string]string{"level": "info"})
+				cm.Annotations = map[string]string{ignoreAnnotation: "true"}
+				return cm
+			},
+		},
+		{
+			name: "ConfigMap gone",
+			cm:   func() *v1.ConfigMap { return nil },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// web mounts the whole ConfigMap and env reads only its level key
+			web, webRS, webPod := testDeployment("web", volumeSpec("app-config"))
+			env, envRS, envPod := testDeployment("env", envKeyRefSpec("app-config", "level"))
+			objs := []runtime.Object{web, webRS, webPod, env, envRS, envPod}
+			if tt.changed != nil {
+				// Only env consumes the changed key
+				web.Spec.Template.Spec.Volumes[0].ConfigMap.Items = []v1.KeyToPath{{Key: "other", Path: "other"}}
+				webPod.Spec = web.Spec.Template.Spec
+			}
+			if cm := tt.cm(); cm != nil {
+				objs = append(objs, cm)
+			}
+			c, clientset := newTestController(t, Options{EnableRestart: true, RestartDefault: true}, objs...)
+			startTestInformers(t, c)
+
+			if err := c.reconcileConfigMap(context.Background(), "default/app-config", "id", tt.changed, tt.resyncOnly); err != nil {
+				t.Fatalf("reconcileConfigMap: %v", err)
+			}
+			got := patchedWorkloads(clientset)
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("patched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleErr(t *testing.T) {
+	const key = "default/app-config"
+	ref := workloadRef{Kind: "Deployment", Namespace: "default", Name: "web"}
+
+	tests := []struct {
+		name         string
+		err          error
+		requeues     int
+		wantRequeues int
+		wantChanged  []string
+		wantRestart  bool
+	}{
+		{name: "success forgets", err: nil, requeues: 2, wantRequeues: 0, wantChanged: []string{}},
+		{
+			name:         "deferred keeps changes without counting a retry",
+			err:          &restartsDeferredError{Deferred: 1, Reason: "rate limit", RetryAfter: time.Hour},
+			wantRequeues: 0,
+			wantChanged:  []string{"level"},
+			wantRestart:  true,
+		},
+		{
+			name:         "error retries with changes",
+			err:          errors.New("boom"),
+			wantRequeues: 1,
+			wantChanged:  []string{"level"},
+			wantRestart:  true,
+		},
+		{
+			name:         "error dropped after max retries",
+			err:          errors.New("boom"),
+			requeues:     maxRetries,
+			wantRequeues: 0,
+			wantChanged:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestController(t, Options{})
+			for range tt.requeues {
+				c.queue.AddRateLimited(key)
+			}
+			c.restarted[key] = map[workloadRef]bool{ref: true}
+
+			c.handleErr(context.Background(), tt.err, key, "id", []string{"level"}, false)
+
+			if got := c.queue.NumRequeues(key); got != tt.wantRequeues {
+				t.Errorf("NumRequeues() = %d, want %d", got, tt.wantRequeues)
+			}
+			if got := c.takeChangedKeys(key); !reflect.DeepEqual(got, tt.wantChanged) {
+				t.Errorf("changed keys = %v, want %v", got, tt.wantChanged)
+			}
+			if got := c.restarted[key][ref]; got != tt.wantRestart {
+				t.Errorf("restarted bookkeeping kept = %v, want %v", got, tt.wantRestart)
+			}
+		})
+	}
+}
+
+func TestHandleErrKeepsResyncOnly(t *testing.T) {
+	const key = "default/app-config"
+	c, _ := newTestController(t, Options{})
+
+	c.handleErr(context.Background(), errors.New("boom"), key, "id", nil, true)
+	if !c.takeResyncOnly(key) {
+		t.Errorf("retry of a resync lost its report-only mark")
+	}
+}
+
+func TestReconcileRestartsConsumersOfChangedKeys(t *testing.T) {
+	itemsSpec := func(keys ...string) v1.PodSpec {
+		spec := volumeSpec("app-config")
+		for _, k := range keys {
+			spec.Volumes[0].ConfigMap.Items = append(spec.Volumes[0].ConfigMap.Items, v1.KeyToPath{Key: k, Path: k})
+		}
+		return spec
+	}
+	projectedSpec := func(key string) v1.PodSpec {
+		return v1.PodSpec{Volumes: []v1.Volume{{
+			Name: "bundle",
+			VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{
+				Sources: []v1.VolumeProjection{{ConfigMap: &v1.ConfigMapProjection{
+					LocalObjectReference: v1.LocalObjectReference{Name: "app-config"},
+					Items:                []v1.KeyToPath{{Key: key, Path: key}},
+				}}},
+			}},
+		}}}
+	}
+	consumers := map[string]v1.PodSpec{
+		"whole-volume": volumeSpec("app-config"),
+		"items-a":      itemsSpec("a"),
+		"items-a-c":    itemsSpec("a", "c"),
+		"projected-b":  projectedSpec("b"),
+		"env-b":        envKeyRefSpec("app-config", "b"),
+		"env-from":     envFromSpec("app-config"),
+	}
+
+	tests := []struct {
+		name    string
+		changed []string
+		want    []string
+	}{
+		{name: "key a", changed: []string{"a"}, want: []string{"env-from", "items-a", "items-a-c", "whole-volume"}},
+		{name: "key b", changed: []string{"b"}, want: []string{"env-b", "env-from", "projected-b", "whole-volume"}},
+		{name: "keys b and c", changed: []string{"b", "c"}, want: []string{"env-b", "env-from", "items-a-c", "projected-b", "whole-volume"}},
+		{name: "unconsumed key", changed: []string{"d"}, want: []string{"env-from", "whole-volume"}},
+		{name: "changed keys unknown", changed: nil, want: []string{"env-b", "env-from", "items-a", "items-a-c", "projected-b", "whole-volume"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs := []runtime.Object{testConfigMap("app-config", map[string]string{"a": "1", "b": "2", "c": "3", "d": "4"})}
+			for name, spec := range consumers {
+				d, rs, pod := testDeployment(name, spec)
+				objs = append(objs, d, rs, pod)
+			}
+			c, clientset := newTestController(t, Options{EnableRestart: true, RestartDefault: true}, objs...)
+			startTestInformers(t, c)
+
+			if err := c.reconcileConfigMap(context.Background(), "default/app-config", "id", tt.changed, false); err != nil {
+				t.Fatalf("reconcileConfigMap: %v", err)
+			}
+			var got []string
+			for _, patched := range patchedWorkloads(clientset) {
+				got = append(got, strings.TrimPrefix(patched, "deployments/"))
+			}
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("restarted %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecreatePollsNotifyOnce(t *testing.T) {
+	var delivered atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered.Add(1)
+	}))
+	defer srv.Close()
+
+	cm := testConfigMap("app-config", map[string]string{"level": "info"})
+	d, rs, pod := testDeployment("web", volumeSpec("app-config"))
+	pod.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	c, clientset := newTestController(t, Options{
+		EnableRestart: true, RestartDefault: true, RestartStrategy: restartStrategyRecreate, RecreateBatchSize: 1,
+		WatchData: true, WebhookURL: srv.URL, WebhookTimeout: time.Second, WebhookQueueSize: 10,
+	}, cm, d, rs, pod)
+	startTestInformers(t, c)
+	ctx := context.Background()
+
+	// The fake API server never deletes evicted Pods, so every pass finds
+	// the recreate still in progress and is requeued under the same ID.
+	// Adding the key stands in for the poll firing
+	const key = "default/app-config"
+	for range 2 {
+		c.queue.Add(key)
+		c.processNextItem(ctx)
+	}
+	evictions := 0
+	for _, action := range clientset.Actions() {
+		if create, ok := action.(k8stesting.CreateAction); ok && create.GetSubresource() == "eviction" {
+			evictions++
+		}
+	}
+	if evictions != 2 {
+		t.Fatalf("evictions = %d, want one per pass of the recreate", evictions)
+	}
+	if n := len(c.webhooks.queue); n != 1 {
+		t.Fatalf("webhooks queued over two recreate polls = %d, want 1", n)
+	}
+
+	// A newer update is notified again
+	updated := cm.DeepCopy()
+	updated.ResourceVersion = "2"
+	updated.Data["level"] = "debug"
+	c.onConfigMapUpdate(cm, updated)
+	if n := c.queue.Len(); n != 1 {
+		t.Fatalf("queue length after a newer update = %d, want 1", n)
+	}
+	c.processNextItem(ctx)
+	if n := len(c.webhooks.queue); n != 2 {
+		t.Fatalf("webhooks queued after a newer update = %d, want 2", n)
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		c.webhooks.run(stop, 0)
+		close(stopped)
+	}()
+	deadline := time.Now().Add(10 * time.Second)
+	for delivered.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+	<-stopped
+	if n := delivered.Load(); n != 2 {
+		t.Errorf("webhooks delivered = %d, want 2", n)
+	}
+}
+
+func TestResyncOnlySendsNoWebhook(t *testing.T) {
+	for _, enableRestart := range []bool{true, false} {
+		t.Run("enableRestart="+strconv.FormatBool(enableRestart), func(t *testing.T) {
+			cm := testConfigMap("app-config", map[string]string{"level": "info"})
+			d, rs, pod := testDeployment("web", volumeSpec("app-config"))
+			c, clientset := newTestController(t, Options{
+				EnableRestart: enableRestart, RestartDefault: true, WebhookURL: "http://webhook.invalid", WebhookQueueSize: 10,
+			}, cm, d, rs, pod)
+			startTestInformers(t, c)
+			ctx := context.Background()
+
+			if err := c.reconcileConfigMap(ctx, "default/app-config", "resync", nil, true); err != nil {
+				t.Fatalf("reconcileConfigMap: %v", err)
+			}
+			if n := len(c.webhooks.queue); n != 0 {
+				t.Errorf("webhooks queued by a resync = %d, want 0", n)
+			}
+			if got := patchedWorkloads(clientset); len(got) != 0 {
+				t.Errorf("resync patched %v, want none", got)
+			}
+
+			if err := c.reconcileConfigMap(ctx, "default/app-config", "update", nil, false); err != nil {
+				t.Fatalf("reconcileConfigMap: %v", err)
+			}
+			if n := len(c.webhooks.queue); n != 1 {
+				t.Errorf("webhooks queued by an update = %d, want 1", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// restartStrategyRollout patches the pod template so the workload
+	// controller performs a managed rollout.
+	restartStrategyRollout = "rollout"
+	// restartStrategyRecreate evicts the workload's pods in batches and lets
+	// the workload controller replace them.
+	restartStrategyRecreate = "recreate"
+)
+
+// recreatePollInterval is how long a ConfigMap is requeued for while pods of
+// a recreate are still being replaced.
+const recreatePollInterval = 10 * time.Second
+
+// recreateState is a recreate in progress.
+type recreateState struct {
+	// started is when the recreate started; pods created before then are
+	// replaced.
+	started time.Time
+	// configMap is the key of the ConfigMap whose reconcile started it.
+	configMap string
+}
+
+// recreating reports whether a recreate of ref is in progress.
+func (c *Controller) recreating(ref workloadRef) bool {
+	c.recreateStartedMu.Lock()
+	defer c.recreateStartedMu.Unlock()
+	_, ok := c.recreateStarted[ref]
+	return ok
+}
+
+// abandonRecreate stops tracking the recreate of ref, so a later restart
+// starts a new one.
+func (c *Controller) abandonRecreate(ref workloadRef) {
+	c.recreateStartedMu.Lock()
+	defer c.recreateStartedMu.Unlock()
+	delete(c.recreateStarted, ref)
+}
+
+// abandonRecreates stops tracking every recreate started by the reconcile
+// of the ConfigMap stored under key, once that reconcile is forgotten.
+func (c *Controller) abandonRecreates(key string) {
+	c.recreateStartedMu.Lock()
+	defer c.recreateStartedMu.Unlock()
+	for ref, state := range c.recreateStarted {
+		if state.configMap == key {
+			delete(c.recreateStarted, ref)
+		}
+	}
+}
+
+// recreatePods evicts the pods of ref created before its recreate started,
+// starting one for the ConfigMap stored under key if none is in progress.
+// Pods already terminating count towards RecreateBatchSize, so no more than
+// that many are replaced at once, and evictions refused by a
+// PodDisruptionBudget are retried on the next call. It returns the number
+// of old pods left.
+func (c *Controller) recreatePods(ctx context.Context, key string, ref workloadRef, pods []*v1.Pod) (int, error) {
+	c.recreateStartedMu.Lock()
+	state, ok := c.recreateStarted[ref]
+	if !ok {
+		state = recreateState{started: time.Now(), configMap: key}
+		c.recreateStarted[ref] = state
+	}
+	c.recreateStartedMu.Unlock()
+	started := state.started
+
+	// Creation timestamps have second precision
+	var old []*v1.Pod
+	inFlight := 0
+	for _, pod := range pods {
+		if !pod.CreationTimestamp.Time.Before(started.Truncate(time.Second)) {
+			continue
+		}
+		old = append(old, pod)
+		if pod.DeletionTimestamp != nil {
+			inFlight++
+		}
+	}
+
+	if len(old) == 0 {
+		c.abandonRecreate(ref)
+		return 0, nil
+	}
+
+	logger := loggerFrom(ctx)
+	for _, pod := range old {
+		if inFlight >= c.opts.RecreateBatchSize {
+			break
+		}
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+
+		eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name}}
+		err := c.clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+		switch {
+		case apierrors.IsNotFound(err):
+			continue
+		case apierrors.IsTooManyRequests(err):
+			logger.Info("Eviction blocked by PodDisruptionBudget, retrying later", "kind", "Pod", "namespace", pod.Namespace, "name", pod.Name,
+				"workload", ref.String())
+			return len(old), nil
+		case err != nil:
+			return len(old), fmt.Errorf("evicting pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+		inFlight++
+		logger.Info("Evicted Pod for recreate", "event", "restart", "kind", "Pod", "namespace", pod.Namespace, "name", pod.Name,
+			"workload", ref.String())
+	}
+	return len(old), nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log/slog"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// configMapReferenced reports whether the ConfigMap stored under key should
+// be handled: always without ReferencedOnly, and otherwise only while at
+// least one cached Pod references it. Skipped keys are remembered so a Pod
+// added later can re-evaluate them.
+func (c *Controller) configMapReferenced(key string) bool {
+	if !c.opts.ReferencedOnly {
+		return true
+	}
+
+	podKeys, err := c.podKeysReferencingConfigMap(key)
+	if err != nil {
+		slog.Error("Error fetching pods from index", "configMap", key, "err", err)
+		return true
+	}
+
+	c.skippedConfigMapsMu.Lock()
+	defer c.skippedConfigMapsMu.Unlock()
+	if len(podKeys) > 0 {
+		delete(c.skippedConfigMaps, key)
+		return true
+	}
+	c.skippedConfigMaps[key] = true
+	return false
+}
+
+// reevaluateSkippedConfigMaps logs every previously skipped ConfigMap the
+// pod references, which is handled again from now on.
+func (c *Controller) reevaluateSkippedConfigMaps(pod *v1.Pod) {
+	if !c.opts.ReferencedOnly {
+		return
+	}
+
+	c.skippedConfigMapsMu.Lock()
+	defer c.skippedConfigMapsMu.Unlock()
+	for _, key := range c.referencedConfigMaps(pod) {
+		if !c.skippedConfigMaps[key] {
+			continue
+		}
+		delete(c.skippedConfigMaps, key)
+		slog.Info("ConfigMap now referenced", "kind", "ConfigMap", "configMap", key, "pod", pod.Namespace+"/"+pod.Name)
+	}
+}
+
+// forgetSkippedConfigMap drops a deleted ConfigMap from the skipped set.
+func (c *Controller) forgetSkippedConfigMap(key string) {
+	c.skippedConfigMapsMu.Lock()
+	defer c.skippedConfigMapsMu.Unlock()
+	delete(c.skippedConfigMaps, key)
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+// How a pod consumes a ConfigMap, as recorded in configMapReference.
+const (
+	refMechanismVolume     = "volume"
+	refMechanismProjected  = "projected"
+	refMechanismEnvFrom    = "envFrom"
+	refMechanismEnvKeyRef  = "envKeyRef"
+	refMechanismAnnotation = "annotation"
+	refMechanismReloader   = "reloader"
+)
+
+// configMapReference is a single place where a pod consumes a ConfigMap.
+type configMapReference struct {
+	Name string
+	// Mechanism is one of the refMechanism constants.
+	Mechanism string
+	// Volume names the volume of volume and projected references.
+	Volume string
+	// Container names the container of envFrom and envKeyRef references,
+	// and EnvVar the variable set by an envKeyRef.
+	Container string
+	EnvVar    string
+	// Keys lists the consumed data keys; empty means every key.
+	Keys     []string
+	Optional bool
+	// EnvPrefix is the prefix of an envFrom reference, prepended to every
+	// variable name it produces.
+	EnvPrefix string
+	// SubPath is set on volume references that a container mounts through
+	// subPath or subPathExpr. Kubelet never refreshes such files, so only a
+	// restart delivers changes.
+	SubPath bool
+}
+
+// configMapReferences returns every ConfigMap reference in the pod spec,
+// in spec order and without deduplication.
+func (c *Controller) configMapReferences(pod *v1.Pod) []configMapReference {
+	return c.podSpecConfigMapReferences(&pod.Spec, pod.Annotations)
+}
+
+// podSpecConfigMapReferences returns every ConfigMap reference in spec and,
+// when -annotation-ref-key is set, in annotations. Pod templates of
+// workloads share it with pods. References without a name are dropped.
+func (c *Controller) podSpecConfigMapReferences(spec *v1.PodSpec, annotations map[string]string) []configMapReference {
+	var refs []configMapReference
+
+	// Volume ConfigMap refs, limited to the mapped items when present
+	subPath := subPathVolumes(spec)
+	for _, vol := range spec.Volumes {
+		if vol.ConfigMap != nil {
+			refs = append(refs, configMapReference{
+				Name:      vol.ConfigMap.Name,
+				Mechanism: refMechanismVolume,
+				Volume:    vol.Name,
+				Keys:      itemKeys(vol.ConfigMap.Items),
+				Optional:  ptr.Deref(vol.ConfigMap.Optional, false),
+				SubPath:   subPath[vol.Name],
+			})
+		}
+		if vol.Projected != nil {
+			for _, source := range vol.Projected.Sources {
+				if source.ConfigMap != nil {
+					refs = append(refs, configMapReference{
+						Name:      source.ConfigMap.Name,
+						Mechanism: refMechanismProjected,
+						Volume:    vol.Name,
+						Keys:      itemKeys(source.ConfigMap.Items),
+						Optional:  ptr.Deref(source.ConfigMap.Optional, false),
+						SubPath:   subPath[vol.Name],
+					})
+				}
+			}
+		}
+	}
+
+	// EnvFrom and Env ConfigMap refs across regular, init and ephemeral
+	// containers, limited to -container-names when set. EnvFrom consumes
+	// every key, Env a single one.
+	forEachContainerEnv(spec, func(container string, envFrom []v1.EnvFromSource, env []v1.EnvVar) {
+		if c.containerNames != nil && !c.containerNames[container] {
+			return
+		}
+		for _, source := range envFrom {
+			if source.ConfigMapRef != nil {
+				refs = append(refs, configMapReference{
+					Name:      source.ConfigMapRef.Name,
+					Mechanism: refMechanismEnvFrom,
+					Container: container,
+					Optional:  ptr.Deref(source.ConfigMapRef.Optional, false),
+					EnvPrefix: source.Prefix,
+				})
+			}
+		}
+		for _, e := range env {
+			if e.ValueFrom != nil && e.ValueFrom.ConfigMapKeyRef != nil {
+				ref := e.ValueFrom.ConfigMapKeyRef
+				refs = append(refs, configMapReference{
+					Name:      ref.Name,
+					Mechanism: refMechanismEnvKeyRef,
+					Container: container,
+					EnvVar:    e.Name,
+					Keys:      []string{ref.Key},
+					Optional:  ptr.Deref(ref.Optional, false),
+				})
+			}
+		}
+	})
+
+	// Annotation ConfigMap refs are informational, so kubelet never
+	// requires them
+	for _, key := range c.opts.AnnotationRefKeys {
+		for _, name := range strings.Split(annotations[key], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				refs = append(refs, configMapReference{Name: name, Mechanism: refMechanismAnnotation, Optional: true})
+			}
+		}
+	}
+
+	// Malformed references without a name would be indexed as "ns/"
+	named := refs[:0]
+	for _, ref := range refs {
+		if ref.Name != "" {
+			named = append(named, ref)
+		}
+	}
+	return named
+}
+
+// subPathVolumes returns the names of the volumes that an init or regular
+// container mounts through subPath or subPathExpr.
+func subPathVolumes(spec *v1.PodSpec) map[string]bool {
+	var volumes map[string]bool
+	for _, containers := range [][]v1.Container{spec.InitContainers, spec.Containers} {
+		for _, c := range containers {
+			for _, m := range c.VolumeMounts {
+				if m.SubPath != "" || m.SubPathExpr != "" {
+					if volumes == nil {
+						volumes = make(map[string]bool)
+					}
+					volumes[m.Name] = true
+				}
+			}
+		}
+	}
+	return volumes
+}
+
+// volumeMounters returns the names of the containers mounting each volume,
+// in init, regular and ephemeral container order.
+func volumeMounters(spec *v1.PodSpec) map[string][]string {
+	mounters := make(map[string][]string)
+	add := func(container string, mounts []v1.VolumeMount) {
+		for _, m := range mounts {
+			mounters[m.Name] = append(mounters[m.Name], container)
+		}
+	}
+	for _, c := range spec.InitContainers {
+		add(c.Name, c.VolumeMounts)
+	}
+	for _, c := range spec.Containers {
+		add(c.Name, c.VolumeMounts)
+	}
+	for _, c := range spec.EphemeralContainers {
+		add(c.Name, c.VolumeMounts)
+	}
+	for volume, containers := range mounters {
+		mounters[volume] = dedupe(containers)
+	}
+	return mounters
+}
+
+// mountsViaSubPath reports whether the pod mounts the named ConfigMap
+// through a subPath.
+func (c *Controller) mountsViaSubPath(pod *v1.Pod, name string) bool {
+	for _, ref := range c.configMapReferences(pod) {
+		if ref.Name == name && ref.SubPath {
+			return true
+		}
+	}
+	return false
+}
+
+func itemKeys(items []v1.KeyToPath) []string {
+	if len(items) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	return keys
+}
+
+// configMapRefIndexFunc indexes pods by the namespace/name keys of the
+// ConfigMaps they reference.
+func (c *Controller) configMapRefIndexFunc(obj any) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return nil, nil
+	}
+	return c.configMapsForPod(pod), nil
+}
+
+// configMapKeyRefIndexFunc indexes pods by the namespace/name/key entries of
+// the ConfigMap keys they consume.
+func (c *Controller) configMapKeyRefIndexFunc(obj any) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return nil, nil
+	}
+	return c.configMapKeysForPod(pod), nil
+}
+
+// secretRefIndexFunc indexes pods by the namespace/name keys of the Secrets
+// they reference.
+func secretRefIndexFunc(obj any) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return nil, nil
+	}
+	return secretsForPod(pod), nil
+}
+
+// nodeNameIndexFunc indexes pods by the node they are scheduled to. Pods not
+// yet scheduled are left out.
+func nodeNameIndexFunc(obj any) ([]string, error) {
+	pod, ok := obj.(*v1.Pod)
+	if !ok || pod.Spec.NodeName == "" {
+		return nil, nil
+	}
+	return []string{pod.Spec.NodeName}, nil
+}
+
+// configMapsForPod returns the deduplicated namespace/name keys of every
+// ConfigMap the pod references. It backs the configMapRef index.
+func (c *Controller) configMapsForPod(pod *v1.Pod) []string {
+	var keys []string
+	for _, ref := range c.configMapReferences(pod) {
+		keys = append(keys, pod.Namespace+"/"+ref.Name)
+	}
+	return dedupe(keys)
+}
+
+// wholeConfigMapKey is the data key recorded in the configMapKeyRef index for
+// references that consume every key of a ConfigMap.
+const wholeConfigMapKey = "*"
+
+// configMapKeysForPod returns the deduplicated namespace/name/key entries of
+// the ConfigMap keys the pod consumes. References to a whole ConfigMap use
+// wholeConfigMapKey. It backs the configMapKeyRef index.
+func (c *Controller) configMapKeysForPod(pod *v1.Pod) []string {
+	var keys []string
+	for _, ref := range c.configMapReferences(pod) {
+		prefix := pod.Namespace + "/" + ref.Name + "/"
+		if len(ref.Keys) == 0 {
+			keys = append(keys, prefix+wholeConfigMapKey)
+			continue
+		}
+		for _, k := range ref.Keys {
+			keys = append(keys, prefix+k)
+		}
+	}
+	return dedupe(keys)
+}
+
+// envFromPrefixes returns the distinct non-empty prefixes under which the pod
+// consumes the named ConfigMap through envFrom.
+func (c *Controller) envFromPrefixes(pod *v1.Pod, name string) []string {
+	var prefixes []string
+	for _, ref := range c.configMapReferences(pod) {
+		if ref.Name == name && ref.EnvPrefix != "" {
+			prefixes = append(prefixes, ref.EnvPrefix)
+		}
+	}
+	return dedupe(prefixes)
+}
+
+// requiredConfigMapsForPod returns the names of the ConfigMaps the pod
+// references at least once without marking the reference optional.
+func (c *Controller) requiredConfigMapsForPod(pod *v1.Pod) []string {
+	var names []string
+	for _, ref := range c.configMapReferences(pod) {
+		if !ref.Optional {
+			names = append(names, ref.Name)
+		}
+	}
+	return dedupe(names)
+}
+
+// podsForConfigMapKeys returns the pods consuming any of dataKeys of the
+// ConfigMap stored under key, including pods consuming the whole ConfigMap,
+// as those whose workload names it in a Reloader annotation do.
+func (c *Controller) podsForConfigMapKeys(key string, dataKeys []string) ([]*v1.Pod, error) {
+	indexer := c.podInformer.GetIndexer()
+
+	seen := make(map[string]bool)
+	var pods []*v1.Pod
+	if c.opts.readsWorkloadAnnotations() {
+		reloaderPods, err := c.reloaderPods(key)
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range reloaderPods {
+			if !seen[pod.Namespace+"/"+pod.Name] {
+				seen[pod.Namespace+"/"+pod.Name] = true
+				pods = append(pods, pod)
+			}
+		}
+	}
+	for _, dataKey := range append([]string{wholeConfigMapKey}, dataKeys...) {
+		objs, err := indexer.ByIndex("configMapKeyRef", key+"/"+dataKey)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			pod, ok := obj.(*v1.Pod)
+			if !ok || seen[pod.Namespace+"/"+pod.Name] {
+				continue
+			}
+			seen[pod.Namespace+"/"+pod.Name] = true
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// secretsForPod returns the deduplicated namespace/name keys of every Secret
+// the pod references. It backs the secretRef index. References without a
+// name are dropped.
+func secretsForPod(pod *v1.Pod) []string {
+	var keys []string
+	add := func(name string) {
+		if name != "" {
+			keys = append(keys, pod.Namespace+"/"+name)
+		}
+	}
+
+	// Volume Secret refs
+	for _, vol := range pod.Spec.Volumes {
+		if vol.Secret != nil {
+			add(vol.Secret.SecretName)
+		}
+		if vol.Projected != nil {
+			for _, source := range vol.Projected.Sources {
+				if source.Secret != nil {
+					add(source.Secret.Name)
+				}
+			}
+		}
+	}
+
+	// EnvFrom and Env Secret refs across regular, init and ephemeral
+	// containers
+	forEachContainerEnv(&pod.Spec, func(_ string, envFrom []v1.EnvFromSource, env []v1.EnvVar) {
+		for _, source := range envFrom {
+			if source.SecretRef != nil {
+				add(source.SecretRef.Name)
+			}
+		}
+		for _, e := range env {
+			if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil {
+				add(e.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+	})
+
+	return dedupe(keys)
+}
+
+// forEachContainerEnv calls fn with the name, envFrom and env of every init,
+// regular and ephemeral container in spec. Every env entry is passed on, so
+// variables sharing a name but sourced from different ConfigMaps each yield
+// a reference.
+func forEachContainerEnv(spec *v1.PodSpec, fn func(container string, envFrom []v1.EnvFromSource, env []v1.EnvVar)) {
+	for _, c := range spec.InitContainers {
+		fn(c.Name, c.EnvFrom, c.Env)
+	}
+	for _, c := range spec.Containers {
+		fn(c.Name, c.EnvFrom, c.Env)
+	}
+	for _, c := range spec.EphemeralContainers {
+		fn(c.Name, c.EnvFrom, c.Env)
+	}
+}
+
+// dedupe removes repeated keys while preserving first-seen order.
+func dedupe(keys []string) []string {
+	if len(keys) < 2 {
+		return keys
+	}
+	seen := make(map[string]struct{}, len(keys))
+	out := keys[:0]
+	for _, k := range keys {
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+		out = append(out, k)
+	}
+	return out
+}
@@ -0,0 +1,447 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+)
+
+// envFromSpec returns a Pod spec loading the named ConfigMap through envFrom.
+func envFromSpec(name string) v1.PodSpec {
+	return v1.PodSpec{
+		Containers: []v1.Container{{
+			Name: "app",
+			EnvFrom: []v1.EnvFromSource{{
+				ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: name}},
+			}},
+		}},
+	}
+}
+
+// envKeyRefSpec returns a Pod spec setting LEVEL from key of the named
+// ConfigMap.
+func envKeyRefSpec(name, key string) v1.PodSpec {
+	return v1.PodSpec{
+		Containers: []v1.Container{{
+			Name: "app",
+			Env: []v1.EnvVar{{
+				Name: "LEVEL",
+				ValueFrom: &v1.EnvVarSource{
+					ConfigMapKeyRef: &v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: name}, Key: key},
+				},
+			}},
+		}},
+	}
+}
+
+func TestConfigMapReferences(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		pod  *v1.Pod
+		want []configMapReference
+	}{
+		{
+			name: "volume",
+			pod:  testPod("web", volumeSpec("app-config")),
+			want: []configMapReference{{Name: "app-config", Mechanism: refMechanismVolume, Volume: "config"}},
+		},
+		{
+			name: "projected volume items",
+			pod: testPod("web", v1.PodSpec{
+				Volumes: []v1.Volume{{
+					Name: "bundle",
+					VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{
+						Sources: []v1.VolumeProjection{{ConfigMap: &v1.ConfigMapProjection{
+							LocalObjectReference: v1.LocalObjectReference{Name: "app-config"},
+							Items:                []v1.KeyToPath{{Key: "a", Path: "a"}},
+						}}},
+					}},
+				}},
+			}),
+			want: []configMapReference{{Name: "app-config", Mechanism: refMechanismProjected, Volume: "bundle", Keys: []string{"a"}}},
+		},
+		{
+			name: "envFrom",
+			pod:  testPod("web", envFromSpec("app-config")),
+			want: []configMapReference{{Name: "app-config", Mechanism: refMechanismEnvFrom, Container: "app"}},
+		},
+		{
+			name: "env valueFrom",
+			pod:  testPod("web", envKeyRefSpec("app-config", "level")),
+			want: []configMapReference{{Name: "app-config", Mechanism: refMechanismEnvKeyRef, Container: "app", EnvVar: "LEVEL", Keys: []string{"level"}}},
+		},
+		{
+			name: "annotation",
+			opts: Options{AnnotationRefKeys: []string{"config.example.com/source"}},
+			pod: func() *v1.Pod {
+				pod := testPod("web", v1.PodSpec{})
+				pod.Annotations = map[string]string{"config.example.com/source": "app-config, ,flags"}
+				return pod
+			}(),
+			want: []configMapReference{
+				{Name: "app-config", Mechanism: refMechanismAnnotation, Optional: true},
+				{Name: "flags", Mechanism: refMechanismAnnotation, Optional: true},
+			},
+		},
+		{
+			name: "no references",
+			pod:  testPod("web", v1.PodSpec{Containers: []v1.Container{{Name: "app"}}}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Controller{opts: tt.opts}
+			if got := c.configMapReferences(tt.pod); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("configMapReferences() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []string
+		want []string
+	}{
+		{name: "nil", keys: nil, want: nil},
+		{name: "single", keys: []string{"a"}, want: []string{"a"}},
+		{name: "no repeats", keys: []string{"b", "a"}, want: []string{"b", "a"}},
+		{name: "repeats keep first-seen order", keys: []string{"b", "a", "b", "c", "a"}, want: []string{"b", "a", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dedupe(slices.Clone(tt.keys)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dedupe(%v) = %v, want %v", tt.keys, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigMapRefIndexFunc(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  any
+		want []string
+	}{
+		{name: "volume", obj: testPod("web", volumeSpec("app-config")), want: []string{"default/app-config"}},
+		{name: "envFrom", obj: testPod("web", envFromSpec("app-config")), want: []string{"default/app-config"}},
+		{name: "env valueFrom", obj: testPod("web", envKeyRefSpec("app-config", "level")), want: []string{"default/app-config"}},
+		{
+			name: "three mechanisms yield one key",
+			obj: testPod("web", v1.PodSpec{
+				Volumes:    volumeSpec("app-config").Volumes,
+				Containers: []v1.Container{{Name: "app", EnvFrom: envFromSpec("app-config").Containers[0].EnvFrom, Env: envKeyRefSpec("app-config", "level").Containers[0].Env}},
+			}),
+			want: []string{"default/app-config"},
+		},
+		{
+			name: "keys in first-seen order",
+			obj: testPod("web", v1.PodSpec{
+				Volumes:    volumeSpec("b-config").Volumes,
+				Containers: []v1.Container{{Name: "app", EnvFrom: envFromSpec("a-config").Containers[0].EnvFrom, Env: envKeyRefSpec("b-config", "level").Containers[0].Env}},
+			}),
+			want: []string{"default/b-config", "default/a-config"},
+		},
+		{
+			name: "init container only",
+			obj: testPod("web", v1.PodSpec{
+				InitContainers: envFromSpec("migrations").Containers,
+				Containers:     []v1.Container{{Name: "app"}},
+			}),
+			want: []string{"default/migrations"},
+		},
+		{
+			name: "ephemeral container only",
+			obj: testPod("web", v1.PodSpec{
+				Containers: []v1.Container{{Name: "app"}},
+				EphemeralContainers: []v1.EphemeralContainer{{
+					EphemeralContainerCommon: v1.EphemeralContainerCommon(envKeyRefSpec("debugging", "trace").Containers[0]),
+				}},
+			}),
+			want: []string{"default/debugging"},
+		},
+		{name: "not a Pod", obj: testConfigMap("app-config", nil), want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Controller{}
+			got, err := c.configMapRefIndexFunc(tt.obj)
+			if err != nil {
+				t.Fatalf("configMapRefIndexFunc: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("configMapRefIndexFunc() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigMapRefIndex(t *testing.T) {
+	objs := []runtime.Object{
+		testConfigMap("app-config", map[string]string{"level": "info"}),
+		testConfigMap("unused", nil),
+		testPod("volume", volumeSpec("app-config")),
+		testPod("env-from", envFromSpec("app-config")),
+		testPod("env-key-ref", envKeyRefSpec("app-config", "level")),
+		testPod("other", volumeSpec("other-config")),
+		testPod("init", v1.PodSpec{InitContainers: envFromSpec("migrations").Containers, Containers: []v1.Container{{Name: "app"}}}),
+	}
+	c, _ := newTestController(t, Options{}, objs...)
+	startTestInformers(t, c)
+
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{key: "default/app-config", want: []string{"env-from", "env-key-ref", "volume"}},
+		{key: "default/other-config", want: []string{"other"}},
+		{key: "default/migrations", want: []string{"init"}},
+		{key: "default/unused", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			objs, err := c.podInformer.GetIndexer().ByIndex("configMapRef", tt.key)
+			if err != nil {
+				t.Fatalf("ByIndex: %v", err)
+			}
+			var got []string
+			for _, obj := range objs {
+				got = append(got, obj.(*v1.Pod).Name)
+			}
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ByIndex(configMapRef, %s) = %v, want %v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvKeyRefsAcrossContainers(t *testing.T) {
+	envVar := func(name, configMap, key string) v1.EnvVar {
+		return v1.EnvVar{Name: name, ValueFrom: &v1.EnvVarSource{
+			ConfigMapKeyRef: &v1.ConfigMapKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: configMap}, Key: key},
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		spec     v1.PodSpec
+		wantRefs []string
+		wantKeys []string
+	}{
+		{
+			name: "several ConfigMaps in one container",
+			spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Env: []v1.EnvVar{
+				envVar("LEVEL", "logging", "level"),
+				envVar("FORMAT", "logging", "format"),
+				envVar("REGION", "region", "name"),
+			}}}},
+			wantRefs: []string{"default/logging", "default/region"},
+			wantKeys: []string{"default/logging/level", "default/logging/format", "default/region/name"},
+		},
+		{
+			name: "same variable from different ConfigMaps",
+			spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", Env: []v1.EnvVar{
+				envVar("LEVEL", "defaults", "level"),
+				envVar("LEVEL", "overrides", "level"),
+			}}}},
+			wantRefs: []string{"default/defaults", "default/overrides"},
+			wantKeys: []string{"default/defaults/level", "default/overrides/level"},
+		},
+		{
+			name: "init, regular and ephemeral containers",
+			spec: v1.PodSpec{
+				InitContainers: []v1.Container{{Name: "migrate", Env: []v1.EnvVar{envVar("DSN", "database", "dsn")}}},
+				Containers:     []v1.Container{{Name: "app", Env: []v1.EnvVar{envVar("LEVEL", "logging", "level")}}},
+				EphemeralContainers: []v1.EphemeralContainer{{EphemeralContainerCommon: v1.EphemeralContainerCommon{
+					Name: "debug", Env: []v1.EnvVar{envVar("TRACE", "debugging", "trace")},
+				}}},
+			},
+			wantRefs: []string{"default/database", "default/logging", "default/debugging"},
+			wantKeys: []string{"default/database/dsn", "default/logging/level", "default/debugging/trace"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Controller{}
+			pod := testPod("web", tt.spec)
+			if got := c.configMapsForPod(pod); !reflect.DeepEqual(got, tt.wantRefs) {
+				t.Errorf("configMapsForPod() = %v, want %v", got, tt.wantRefs)
+			}
+			if got := c.configMapKeysForPod(pod); !reflect.DeepEqual(got, tt.wantKeys) {
+				t.Errorf("configMapKeysForPod() = %v, want %v", got, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestEmptyConfigMapNamesNotIndexed(t *testing.T) {
+	tests := []struct {
+		name string
+		spec v1.PodSpec
+	}{
+		{name: "volume", spec: volumeSpec("")},
+		{
+			name: "projected volume",
+			spec: v1.PodSpec{Volumes: []v1.Volume{{
+				Name: "bundle",
+				VolumeSource: v1.VolumeSource{Projected: &v1.ProjectedVolumeSource{
+					Sources: []v1.VolumeProjection{{ConfigMap: &v1.ConfigMapProjection{}}},
+				}},
+			}}},
+		},
+		{name: "envFrom", spec: envFromSpec("")},
+		{name: "env valueFrom", spec: envKeyRefSpec("", "level")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Controller{}
+			pod := testPod("web", tt.spec)
+			if keys, _ := c.configMapRefIndexFunc(pod); len(keys) != 0 {
+				t.Errorf("configMapRefIndexFunc() = %v, want no keys", keys)
+			}
+			if keys, _ := c.configMapKeyRefIndexFunc(pod); len(keys) != 0 {
+				t.Errorf("configMapKeyRefIndexFunc() = %v, want no keys", keys)
+			}
+		})
+	}
+}
+
+func TestVolumeItemsLimitConsumedKeys(t *testing.T) {
+	itemsSpec := func(keys ...string) v1.PodSpec {
+		spec := volumeSpec("app-config")
+		for _, k := range keys {
+			spec.Volumes[0].ConfigMap.Items = append(spec.Volumes[0].ConfigMap.Items, v1.KeyToPath{Key: k, Path: "conf/" + k})
+		}
+		return spec
+	}
+	objs := []runtime.Object{
+		testConfigMap("app-config", map[string]string{"a": "1", "b": "2", "c": "3"}),
+		testPod("whole", volumeSpec("app-config")),
+		testPod("items-a", itemsSpec("a")),
+		testPod("items-a-b", itemsSpec("a", "b")),
+	}
+	c, _ := newTestController(t, Options{}, objs...)
+	startTestInformers(t, c)
+
+	if got, want := c.configMapKeysForPod(objs[3].(*v1.Pod)), []string{"default/app-config/a", "default/app-config/b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("configMapKeysForPod(items-a-b) = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		name    string
+		changed []string
+		want    []string
+	}{
+		{name: "mapped by both", changed: []string{"a"}, want: []string{"items-a", "items-a-b", "whole"}},
+		{name: "mapped by one", changed: []string{"b"}, want: []string{"items-a-b", "whole"}},
+		{name: "unmapped", changed: []string{"c"}, want: []string{"whole"}},
+		{name: "mapped and unmapped", changed: []string{"b", "c"}, want: []string{"items-a-b", "whole"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pods, err := c.podsForConfigMapKeys("default/app-config", tt.changed)
+			if err != nil {
+				t.Fatalf("podsForConfigMapKeys: %v", err)
+			}
+			var got []string
+			for _, pod := range pods {
+				got = append(got, pod.Name)
+			}
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("podsForConfigMapKeys(%v) = %v, want %v", tt.changed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerNamesFilter(t *testing.T) {
+	sidecar := envFromSpec("sidecar-config").Containers[0]
+	sidecar.Name = "sidecar"
+	app := envKeyRefSpec("level-config", "level").Containers[0]
+	app.EnvFrom = envFromSpec("app-config").Containers[0].EnvFrom
+	pod := testPod("web", v1.PodSpec{
+		Volumes:    volumeSpec("shared-config").Volumes,
+		Containers: []v1.Container{sidecar, app},
+	})
+
+	tests := []struct {
+		name       string
+		containers []string
+		want       []string
+	}{
+		{
+			name: "every container",
+			want: []string{"default/shared-config", "default/sidecar-config", "default/app-config", "default/level-config"},
+		},
+		{
+			name:       "app only",
+			containers: []string{"app"},
+			want:       []string{"default/shared-config", "default/app-config", "default/level-config"},
+		},
+		{
+			name:       "sidecar only",
+			containers: []string{"sidecar"},
+			want:       []string{"default/shared-config", "default/sidecar-config"},
+		},
+		{
+			name:       "no such container keeps volumes",
+			containers: []string{"missing"},
+			want:       []string{"default/shared-config"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestController(t, Options{ContainerNames: tt.containers})
+			got, err := c.configMapRefIndexFunc(pod)
+			if err != nil {
+				t.Fatalf("configMapRefIndexFunc: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("configMapRefIndexFunc() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// An immutable ConfigMap consumed through env forces a restart even at the
+// same checksum, but only when a selected container consumes it.
+func TestContainerNamesFilterImmutableRestart(t *testing.T) {
+	sidecar := envFromSpec("app-config").Containers[0]
+	sidecar.Name = "sidecar"
+	spec := volumeSpec("app-config")
+	spec.Containers = append(spec.Containers, sidecar)
+
+	tests := []struct {
+		name        string
+		containers  []string
+		wantPatched []string
+	}{
+		{name: "every container", wantPatched: []string{"deployments/web"}},
+		{name: "sidecar filtered out", containers: []string{"app"}, wantPatched: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := testConfigMap("app-config", map[string]string{"level": "info"})
+			cm.Immutable = ptr.To(true)
+			d, rs, pod := testDeployment("web", spec)
+			d.Spec.Template.Annotations = map[string]string{checksumAnnotation: (&Controller{}).restartChecksum(cm)}
+			c, clientset := newTestController(t, Options{EnableRestart: true, RestartDefault: true, ContainerNames: tt.containers}, d, rs)
+
+			if err := c.restartWorkloads(context.Background(), cm, []any{pod}, make(map[workloadRef]bool)); err != nil {
+				t.Fatalf("restartWorkloads: %v", err)
+			}
+			if got := patchedWorkloads(clientset); !reflect.DeepEqual(got, tt.wantPatched) {
+				t.Errorf("patched %v, want %v", got, tt.wantPatched)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// reloadable maps the flag names accepted in the reload file to parsers
+// returning a function that applies the new value to a controller. The log
+// level is global and reloaded through logLevel.
+var reloadable = map[string]func(c *Controller, value string) (func(), error){
+	"log-level": func(c *Controller, value string) (func(), error) {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return nil, err
+		}
+		return func() { logLevel.Set(level) }, nil
+	},
+	"debounce-window": func(c *Controller, value string) (func(), error) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, err
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("must not be negative")
+		}
+		return func() { c.debounceWindow.Store(int64(d)) }, nil
+	},
+	"dry-run": func(c *Controller, value string) (func(), error) {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		return func() { c.dryRun.Store(b) }, nil
+	},
+}
+
+// watchReloadSignal reloads the settings in -reload-file on every SIGHUP
+// until stopCh is closed. Without a reload file the signal is only logged.
+func (c *Controller) watchReloadSignal(stopCh <-chan struct{}) {
+	path := c.opts.ReloadFile
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-sigCh:
+			if path == "" {
+				slog.Warn("SIGHUP received but -reload-file is not set, nothing to reload")
+				continue
+			}
+			if err := c.reloadSettings(path); err != nil {
+				slog.Error("Error reloading settings, keeping current values", "path", path, "err", err)
+			}
+		}
+	}
+}
+
+// reloadSettings reads name=value lines from path, one flag per line, and
+// applies them. All values are validated before any is applied, so a bad
+// file changes nothing. Flags that cannot be changed at runtime are logged
+// and ignored.
+func (c *Controller) reloadSettings(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var (
+		apply       []func()
+		reloaded    []string
+		restartOnly []string
+	)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("line %d: expected name=value", i+1)
+		}
+		name = strings.TrimLeft(strings.TrimSpace(name), "-")
+		value = strings.TrimSpace(value)
+
+		parse, ok := reloadable[name]
+		if !ok {
+			if flag.Lookup(name) == nil {
+				return fmt.Errorf("line %d: unknown setting %q", i+1, name)
+			}
+			restartOnly = append(restartOnly, name)
+			continue
+		}
+		fn, err := parse(c, value)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid %s %q: %w", i+1, name, value, err)
+		}
+		apply = append(apply, fn)
+		reloaded = append(reloaded, name+"="+value)
+	}
+
+	for _, fn := range apply {
+		fn()
+	}
+	slog.Info("Reloaded settings", "path", path, "reloaded", reloaded)
+	if len(restartOnly) > 0 {
+		slog.Warn("Ignoring settings that require a restart", "path", path, "settings", restartOnly)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// reloaderAnnotationKeys are the Deployment, StatefulSet and DaemonSet
+// annotations listing ConfigMap names that Stakater Reloader reads;
+// -reloader-compat appends them to -reference-annotations.
+var reloaderAnnotationKeys = []string{"configmap.reloader.stakater.com/reload"}
+
+// reloaderAutoAnnotations set to "true" on a workload make Stakater Reloader
+// restart it whenever a ConfigMap it references changes.
+var reloaderAutoAnnotations = []string{"reloader.stakater.com/auto", "configmap.reloader.stakater.com/auto"}
+
+// readsWorkloadAnnotations reports whether the annotations of Deployments,
+// StatefulSets and DaemonSets are read, which needs their informers.
+func (o Options) readsWorkloadAnnotations() bool {
+	return o.ReloaderCompat || len(o.ReferenceAnnotations) > 0
+}
+
+// reloaderConfigMapNames returns the deduplicated ConfigMap names listed in
+// the ReferenceAnnotations of a workload.
+func (c *Controller) reloaderConfigMapNames(workload metav1.Object) []string {
+	var names []string
+	for _, key := range c.opts.ReferenceAnnotations {
+		for _, name := range strings.Split(workload.GetAnnotations()[key], ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return dedupe(names)
+}
+
+// reloaderOptIn reports whether the Reloader annotations of a workload ask
+// for it to be restarted when the named ConfigMap changes: an auto
+// annotation set to "true", or a reference annotation naming that ConfigMap.
+func (c *Controller) reloaderOptIn(workload metav1.Object, configMap string) bool {
+	for _, key := range reloaderAutoAnnotations {
+		if auto, ok := boolAnnotation(workload, key); ok && auto {
+			return true
+		}
+	}
+	return slices.Contains(c.reloaderConfigMapNames(workload), configMap)
+}
+
+// reloaderConfigMapRefIndexFunc indexes workloads by the namespace/name keys
+// of the ConfigMaps named in their ReferenceAnnotations.
+func (c *Controller) reloaderConfigMapRefIndexFunc(obj any) ([]string, error) {
+	workload, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, nil
+	}
+	var keys []string
+	for _, name := range c.reloaderConfigMapNames(workload) {
+		keys = append(keys, workload.GetNamespace()+"/"+name)
+	}
+	return keys, nil
+}
+
+// controllerIndexFunc indexes objects by the Kind/namespace/name of their
+// controller.
+func controllerIndexFunc(obj any) ([]string, error) {
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, nil
+	}
+	owner := metav1.GetControllerOf(object)
+	if owner == nil {
+		return nil, nil
+	}
+	return []string{owner.Kind + "/" + object.GetNamespace() + "/" + owner.Name}, nil
+}
+
+// reloaderWorkloadInformers returns the informers of the workloads whose
+// annotations are read; none unless readsWorkloadAnnotations.
+func (c *Controller) reloaderWorkloadInformers() []cache.SharedIndexInformer {
+	if !c.opts.readsWorkloadAnnotations() {
+		return nil
+	}
+	return []cache.SharedIndexInformer{c.deploymentInformer, c.statefulSetInformer, c.daemonSetInformer}
+}
+
+// reloaderPods returns the cached Pods of every workload whose Reloader
+// annotations name the ConfigMap stored under key. Deployments are followed
+// through their ReplicaSets.
+func (c *Controller) reloaderPods(key string) ([]*v1.Pod, error) {
+	var pods []*v1.Pod
+	addPods := func(controller string) error {
+		objs, err := c.podInformer.GetIndexer().ByIndex("controller", controller)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objs {
+			if pod, ok := obj.(*v1.Pod); ok {
+				pods = append(pods, pod)
+			}
+		}
+		return nil
+	}
+
+	for _, informer := range c.reloaderWorkloadInformers() {
+		objs, err := informer.GetIndexer().ByIndex("reloaderConfigMapRef", key)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objs {
+			switch workload := obj.(type) {
+			case *appsv1.Deployment:
+				replicaSets, err := c.replicaSetInformer.GetIndexer().ByIndex("controller", "Deployment/"+workload.Namespace+"/"+workload.Name)
+				if err != nil {
+					return nil, err
+				}
+				for _, obj := range replicaSets {
+					if rs, ok := obj.(*appsv1.ReplicaSet); ok {
+						if err := addPods("ReplicaSet/" + rs.Namespace + "/" + rs.Name); err != nil {
+							return nil, err
+						}
+					}
+				}
+			case *appsv1.StatefulSet:
+				if err := addPods("StatefulSet/" + workload.Namespace + "/" + workload.Name); err != nil {
+					return nil, err
+				}
+			case *appsv1.DaemonSet:
+				if err := addPods("DaemonSet/" + workload.Namespace + "/" + workload.Name); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return pods, nil
+}
+
+// podsReferencingConfigMap returns the cached Pods referencing the ConfigMap
+// stored under key, either themselves or, with readsWorkloadAnnotations,
+// through the ReferenceAnnotations of their workload. It is the configMapRef index
+// lookup extended to workload annotations, which no Pod index can hold
+// without going stale when only the workload changes.
+func (c *Controller) podsReferencingConfigMap(key string) ([]any, error) {
+	objs, err := c.podInformer.GetIndexer().ByIndex("configMapRef", key)
+	if err != nil || !c.opts.readsWorkloadAnnotations() {
+		return objs, err
+	}
+	pods, err := c.reloaderPods(key)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(objs))
+	for _, obj := range objs {
+		if pod, ok := obj.(*v1.Pod); ok {
+			seen[pod.Namespace+"/"+pod.Name] = true
+		}
+	}
+	for _, pod := range pods {
+		if !seen[pod.Namespace+"/"+pod.Name] {
+			seen[pod.Namespace+"/"+pod.Name] = true
+			objs = append(objs, pod)
+		}
+	}
+	return objs, nil
+}
+
+// podKeysReferencingConfigMap returns the store keys of the Pods returned by
+// podsReferencingConfigMap.
+func (c *Controller) podKeysReferencingConfigMap(key string) ([]string, error) {
+	if !c.opts.readsWorkloadAnnotations() {
+		return c.podInformer.GetIndexer().IndexKeys("configMapRef", key)
+	}
+	objs, err := c.podsReferencingConfigMap(key)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		if pod, ok := obj.(*v1.Pod); ok {
+			keys = append(keys, pod.Namespace+"/"+pod.Name)
+		}
+	}
+	return keys, nil
+}
+
+// cachedReloaderWorkload returns the cached workload owning pod whose
+// Reloader annotations are read, and false when there is none.
+func (c *Controller) cachedReloaderWorkload(pod *v1.Pod) (metav1.Object, bool) {
+	var informer cache.SharedIndexInformer
+	ref := c.cachedWorkload(pod)
+	switch ref.Kind {
+	case "Deployment":
+		informer = c.deploymentInformer
+	case "StatefulSet":
+		informer = c.statefulSetInformer
+	case "DaemonSet":
+		informer = c.daemonSetInformer
+	}
+	if informer == nil {
+		return nil, false
+	}
+	obj, exists, err := informer.GetIndexer().GetByKey(ref.Namespace + "/" + ref.Name)
+	if err != nil || !exists {
+		return nil, false
+	}
+	workload, err := meta.Accessor(obj)
+	return workload, err == nil
+}
+
+// reloaderReferences returns the references of pod to the ConfigMaps named
+// in the ReferenceAnnotations of its workload; none unless
+// readsWorkloadAnnotations.
+// Like annotation references they are optional.
+func (c *Controller) reloaderReferences(pod *v1.Pod) []configMapReference {
+	if !c.opts.readsWorkloadAnnotations() {
+		return nil
+	}
+	workload, ok := c.cachedReloaderWorkload(pod)
+	if !ok {
+		return nil
+	}
+	var refs []configMapReference
+	for _, name := range c.reloaderConfigMapNames(workload) {
+		refs = append(refs, configMapReference{Name: name, Mechanism: refMechanismReloader, Optional: true})
+	}
+	return refs
+}
+
+// referencedConfigMaps returns the deduplicated namespace/name keys of every
+// ConfigMap the pod references, including through the Reloader annotations
+// of its workload.
+func (c *Controller) referencedConfigMaps(pod *v1.Pod) []string {
+	keys := c.configMapsForPod(pod)
+	for _, ref := range c.reloaderReferences(pod) {
+		keys = append(keys, pod.Namespace+"/"+ref.Name)
+	}
+	return dedupe(keys)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReloaderPods(t *testing.T) {
+	spec := v1.PodSpec{Containers: []v1.Container{{Name: "app"}}}
+	web, webRS, webPod := testDeployment("web", spec)
+	web.Annotations = map[string]string{"configmap.reloader.stakater.com/reload": "app-config"}
+	plain, plainRS, plainPod := testDeployment("plain", spec)
+	db := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "db",
+		Annotations: map[string]string{"configmap.reloader.stakater.com/reload": "other-config, app-config"},
+	}}
+	dbPod := testPod("db-0", spec)
+	controlledBy(dbPod, "StatefulSet", "db")
+	agent := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "default",
+		Name:        "agent",
+		Annotations: map[string]string{"config.example.com/configmaps": "app-config"},
+	}}
+	agentPod := testPod("agent-xyz", spec)
+	controlledBy(agentPod, "DaemonSet", "agent")
+	volume := testPod("volume", volumeSpec("app-config"))
+
+	tests := []struct {
+		name        string
+		annotations []string
+		key         string
+		want        []string
+	}{
+		{name: "no reference annotations", key: "default/app-config", want: []string{"volume"}},
+		{name: "reloader annotation", annotations: reloaderAnnotationKeys, key: "default/app-config", want: []string{"db-0", "volume", "web-abc-1"}},
+		{name: "second name in the annotation", annotations: reloaderAnnotationKeys, key: "default/other-config", want: []string{"db-0"}},
+		{name: "unnamed ConfigMap", annotations: reloaderAnnotationKeys, key: "default/unused", want: nil},
+		{name: "custom annotation", annotations: []string{"config.example.com/configmaps"}, key: "default/app-config", want: []string{"agent-xyz", "volume"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestController(t, Options{ReferenceAnnotations: tt.annotations},
+				web, webRS, webPod, plain, plainRS, plainPod, db, dbPod, agent, agentPod, volume)
+			startTestInformers(t, c)
+
+			objs, err := c.podsReferencingConfigMap(tt.key)
+			if err != nil {
+				t.Fatalf("podsReferencingConfigMap: %v", err)
+			}
+			var got []string
+			for _, obj := range objs {
+				got = append(got, obj.(*v1.Pod).Name)
+			}
+			slices.Sort(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("podsReferencingConfigMap(%s) = %v, want %v", tt.key, got, tt.want)
+			}
+
+			keys, err := c.podKeysReferencingConfigMap(tt.key)
+			if err != nil {
+				t.Fatalf("podKeysReferencingConfigMap: %v", err)
+			}
+			if len(keys) != len(tt.want) {
+				t.Errorf("podKeysReferencingConfigMap(%s) = %v, want %d keys", tt.key, keys, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestReloaderRestartPolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		reloaderCompat bool
+		annotations    map[string]string
+		configMap      string
+		wantRestart    bool
+		wantPolicy     string
+	}{
+		{name: "auto", reloaderCompat: true, annotations: map[string]string{"reloader.stakater.com/auto": "true"}, wantRestart: true, wantPolicy: "reloader"},
+		{name: "configmap auto", reloaderCompat: true, annotations: map[string]string{"configmap.reloader.stakater.com/auto": "true"}, wantRestart: true, wantPolicy: "reloader"},
+		{name: "auto false", reloaderCompat: true, annotations: map[string]string{"reloader.stakater.com/auto": "false"}, wantRestart: false, wantPolicy: "default"},
+		{name: "reload names the ConfigMap", reloaderCompat: true, annotations: map[string]string{"configmap.reloader.stakater.com/reload": "app-config"}, wantRestart: true, wantPolicy: "reloader"},
+		{
+			name:           "reload names another ConfigMap",
+			reloaderCompat: true,
+			annotations:    map[string]string{"configmap.reloader.stakater.com/reload": "app-config"},
+			configMap:      "other-config",
+			wantRestart:    false,
+			wantPolicy:     "default",
+		},
+		{
+			name:           "restart annotation wins",
+			reloaderCompat: true,
+			annotations:    map[string]string{"reloader.stakater.com/auto": "true", restartAnnotation: "false"},
+			wantRestart:    false,
+			wantPolicy:     "annotation",
+		},
+		{name: "compat off", annotations: map[string]string{"reloader.stakater.com/auto": "true"}, wantRestart: false, wantPolicy: "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Controller{opts: Options{ReloaderCompat: tt.reloaderCompat, ReferenceAnnotations: reloaderAnnotationKeys}}
+			d, _, _ := testDeployment("web", volumeSpec("app-config"))
+			d.Annotations = tt.annotations
+			configMap := tt.configMap
+			if configMap == "" {
+				configMap = "app-config"
+			}
+
+			restart, policy := c.workloadRestartPolicy(d, configMap)
+			if restart != tt.wantRestart || policy != tt.wantPolicy {
+				t.Errorf("workloadRestartPolicy() = %v, %q, want %v, %q", restart, policy, tt.wantRestart, tt.wantPolicy)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// configMapPodsEntry is a cached ConfigMap with the Pods referencing it.
+type configMapPodsEntry struct {
+	Namespace string      `json:"namespace"`
+	Name      string      `json:"name"`
+	Pods      []objectRef `json:"pods"`
+}
+
+// referenceGraph returns every cached ConfigMap with the Pods referencing
+// it, both sorted by namespace then name.
+func (c *Controller) referenceGraph() ([]configMapPodsEntry, error) {
+	var cms []*v1.ConfigMap
+	for _, obj := range c.configMapInformer.GetStore().List() {
+		if cm, ok := obj.(*v1.ConfigMap); ok {
+			cms = append(cms, cm)
+		}
+	}
+	sort.Slice(cms, func(i, j int) bool {
+		if cms[i].Namespace != cms[j].Namespace {
+			return cms[i].Namespace < cms[j].Namespace
+		}
+		return cms[i].Name < cms[j].Name
+	})
+
+	entries := make([]configMapPodsEntry, 0, len(cms))
+	for _, cm := range cms {
+		key := cm.Namespace + "/" + cm.Name
+		objs, err := c.podsReferencingConfigMap(key)
+		if err != nil {
+			return nil, fmt.Errorf("fetching pods for %s from index: %w", key, err)
+		}
+		entries = append(entries, configMapPodsEntry{Namespace: cm.Namespace, Name: cm.Name, Pods: podRefs(objs)})
+	}
+	return entries, nil
+}
+
+// printReport writes every cached ConfigMap followed by the Pods referencing
+// it, sorted by namespace then name so reports can be diffed.
+func (c *Controller) printReport(w io.Writer) error {
+	entries, err := c.referenceGraph()
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if _, err := fmt.Fprintf(w, "%s/%s (%d pods)\n", entry.Namespace, entry.Name, len(entry.Pods)); err != nil {
+			return err
+		}
+		for _, pod := range entry.Pods {
+			if _, err := fmt.Fprintf(w, "  - %s/%s\n", pod.Namespace, pod.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
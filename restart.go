@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+	checksumAnnotation    = "config-watcher/checksum"
+)
+
+// workloadRef identifies a pod-owning controller that can be restarted.
+type workloadRef struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+func (w workloadRef) String() string {
+	return w.Kind + " " + w.Namespace + "/" + w.Name
+}
+
+// restartWorkloads triggers a rolling restart of every workload owning one of
+// the given pods and not already present in done. Each workload is restarted
+// at most once and recorded in done, and workloads consuming the ConfigMap
+// through a subPath mount go first since kubelet never refreshes those files
+// in place. With the recreate strategy a workload is recorded in done only
+// once all its old pods are replaced, and the ConfigMap is requeued until
+// then.
+func (c *Controller) restartWorkloads(ctx context.Context, cm *v1.ConfigMap, pods []any, done map[workloadRef]bool) error {
+	logger := loggerFrom(ctx)
+
+	type target struct {
+		ref     workloadRef
+		pods    []*v1.Pod
+		subPath bool
+		env     bool
+	}
+
+	var (
+		targets []target
+		errs    []error
+	)
+	seen := make(map[workloadRef]int)
+
+	for _, obj := range pods {
+		pod, ok := obj.(*v1.Pod)
+		if !ok {
+			continue
+		}
+		// Completed Pods no longer consume the ConfigMap
+		if podTerminated(pod) {
+			logger.Debug("Skipping Pod in terminal phase", "kind", "Pod", "namespace", pod.Namespace, "name", pod.Name, "phase", pod.Status.Phase)
+			continue
+		}
+
+		ref, ok, err := c.resolveWorkload(ctx, pod)
+		if err != nil {
+			logger.Error("Error resolving Pod owner", "kind", "Pod", "namespace", pod.Namespace, "name", pod.Name, "err", err)
+			errs = append(errs, err)
+			continue
+		}
+		if !ok {
+			logger.Info("Skipping Pod without restartable controller owner", "kind", "Pod", "namespace", pod.Namespace, "name", pod.Name)
+			continue
+		}
+
+		if done[ref] {
+			continue
+		}
+		if c.restartNamespaces != nil && !c.restartNamespaces[ref.Namespace] {
+			done[ref] = true
+			logger.Info("Workload namespace not in -restart-namespaces, skipping restart", "kind", ref.Kind, "namespace", ref.Namespace, "name", ref.Name,
+				"configMap", cm.Namespace+"/"+cm.Name)
+			continue
+		}
+
+		subPath := c.mountsViaSubPath(pod, cm.Name)
+		env := c.usesEnv(pod, cm.Name)
+		if i, dup := seen[ref]; dup {
+			targets[i].pods = append(targets[i].pods, pod)
+			targets[i].subPath = targets[i].subPath || subPath
+			targets[i].env = targets[i].env || env
+			continue
+		}
+		seen[ref] = len(targets)
+		targets = append(targets, target{ref: ref, pods: []*v1.Pod{pod}, subPath: subPath, env: env})
+	}
+
+	sort.SliceStable(targets, func(i, j int) bool {
+		return targets[i].subPath && !targets[j].subPath
+	})
+
+	checksum := c.restartChecksum(cm)
+	immutable := ptr.Deref(cm.Immutable, false)
+	key := cm.Namespace + "/" + cm.Name
+	replaced := c.configMapReplaced(key)
+	limited := make(map[string]bool)
+	recreate := c.opts.RestartStrategy == restartStrategyRecreate
+	deferred, paused, recreating, cooling := 0, 0, 0, 0
+	var cooldownWait time.Duration
+	for _, t := range targets {
+		// A recreate already let through continues on every pass until its
+		// old pods are replaced. It goes through the same checks, but does
+		// not count again against the cooldown or the rate limit
+		inProgress := recreate && c.recreating(t.ref)
+
+		workload, template, err := c.getWorkload(ctx, t.ref)
+		if err != nil {
+			logger.Error("Error fetching workload", "kind", t.ref.Kind, "namespace", t.ref.Namespace, "name", t.ref.Name, "err", err)
+			errs = append(errs, err)
+			if inProgress {
+				c.abandonRecreate(t.ref)
+			}
+			continue
+		}
+
+		restart, policy := c.workloadRestartPolicy(workload, cm.Name)
+		if !restart {
+			done[t.ref] = true
+			c.abandonRecreate(t.ref)
+			logger.Info("Workload opted out of restarts, skipping", "kind", t.ref.Kind, "namespace", t.ref.Namespace, "name", t.ref.Name,
+				"configMap", key, "policy", policy)
+			continue
+		}
+
+		// Consumers of an immutable ConfigMap through subPath or env can
+		// never reload it, so they are restarted even at the same checksum,
+		// and once it is replaced so are those mounting it, since kubelet
+		// does not refresh immutable volumes either. Recreates leave the
+		// template untouched, so it carries no checksum
+		force := immutable && (t.subPath || t.env || replaced)
+		if !recreate && template.Annotations[checksumAnnotation] == checksum && !force {
+			done[t.ref] = true
+			logger.Info("Workload already at ConfigMap checksum, skipping restart", "kind", t.ref.Kind, "namespace", t.ref.Namespace, "name", t.ref.Name,
+				"configMap", cm.Namespace+"/"+cm.Name, "checksum", checksum)
+			continue
+		}
+
+		if c.dryRun.Load() {
+			done[t.ref] = true
+			c.abandonRecreate(t.ref)
+			restartsSkippedDryRun.Inc()
+			logger.Info("Would restart workload (dry run)", "event", "restart", "kind", t.ref.Kind, "namespace", t.ref.Namespace, "name", t.ref.Name,
+				"configMap", cm.Namespace+"/"+cm.Name, "subPath", t.subPath)
+			continue
+		}
+
+		// The restart is retried once the cooldown ends, and then skipped
+		// at the checksum check if the rollout already picked up the change
+		if wait := c.restartCooldownRemaining(t.ref); !inProgress && wait > 0 {
+			cooling++
+			if cooldownWait == 0 || wait < cooldownWait {
+				cooldownWait = wait
+			}
+			logger.Info("Workload restarted recently, deferring restart until its cooldown ends", "kind", t.ref.Kind, "namespace", t.ref.Namespace, "name", t.ref.Name,
+				"configMap", key, "cooldown", c.opts.RestartCooldown, "retryIn", wait.Round(time.Second))
+			continue
+		}
+
+		// A recreate in progress is stopped once its pods crash-loop, while
+		// the probe of a half-open circuit runs to completion
+		if (inProgress && c.circuitOpen(key)) || (!inProgress && !c.circuitAllowsRestart(ctx, key)) {
+			c.abandonRecreate(t.ref)
+			paused++
+			continue
+		}
+
+		if !inProgress && (limited[t.ref.Namespace] || !c.allowRestart(t.ref.Namespace)) {
+			limited[t.ref.Namespace] = true
+			deferred++
+			restartsRateLimited.Inc()
+			continue
+		}
+
+		if recreate {
+			remaining, err := c.recreatePods(ctx, key, t.ref, t.pods)
+			if err != nil {
+				logger.Error("Error recreating workload Pods", "kind", t.ref.Kind, "namespace", t.ref.Namespace, "name", t.ref.Name, "err", err)
+				errs = append(errs, err)
+				c.abandonRecreate(t.ref)
+				continue
+			}
+			if remaining > 0 {
+				recreating++
+			} else {
+				done[t.ref] = true
+			}
+			if inProgress {
+				if remaining == 0 {
+					logger.Info("Recreated workload Pods", "event", "restart", "kind", t.ref.Kind, "namespace", t.ref.Namespace, "name", t.ref.Name,
+						"configMap", key)
+				}
+				continue
+			}
+		} else {
+			if err := c.restartWorkload(ctx, t.ref, checksum); err != nil {
+				logger.Error("Error restarting workload", "kind", t.ref.Kind, "namespace", t.ref.Namespace, "name", t.ref.Name, "err", err)
+				errs = append(errs, err)
+				continue
+			}
+			done[t.ref] = true
+		}
+		c.recordRestartCooldown(t.ref)
+		c.recordCircuitRestart(key, t.ref)
+		logger.Info("Restarted workload", "event", "restart", "kind", t.ref.Kind, "namespace", t.ref.Namespace, "name", t.ref.Name,
+			"configMap", cm.Namespace+"/"+cm.Name, "subPath", t.subPath, "policy", policy, "strategy", c.opts.RestartStrategy)
+	}
+
+	if paused > 0 {
+		logger.Warn("Restart circuit open, skipping restarts", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name, "skipped", paused)
+	}
+	// The ConfigMap is requeued for the first deferral to end; a pass before
+	// the others end defers them again
+	var retry *restartsDeferredError
+	if deferred > 0 {
+		logger.Warn("Restart rate limit exceeded, deferring restarts", "kind", "ConfigMap", "namespace", cm.Namespace, "name", cm.Name,
+			"deferred", deferred, "maxRestartsPerMinute", c.opts.MaxRestartsPerMinute)
+		retry = earliestRetry(retry, &restartsDeferredError{Deferred: deferred, Reason: "rate limit", RetryAfter: c.restartInterval()})
+	}
+	if cooling > 0 {
+		retry = earliestRetry(retry, &restartsDeferredError{Deferred: cooling, Reason: "restart cooldown", RetryAfter: cooldownWait})
+	}
+	if recreating > 0 {
+		retry = earliestRetry(retry, &restartsDeferredError{Deferred: recreating, Reason: "recreate in progress", RetryAfter: recreatePollInterval})
+	}
+	if retry != nil && len(errs) == 0 {
+		return retry
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// resolveWorkload walks a pod's controller ownerReferences up to the owning
+// Deployment, StatefulSet or DaemonSet. It returns false when the pod has no
+// controller owner or is owned by a kind that cannot be restarted.
+func (c *Controller) resolveWorkload(ctx context.Context, pod *v1.Pod) (workloadRef, bool, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return workloadRef{}, false, nil
+	}
+
+	switch owner.Kind {
+	case "StatefulSet", "DaemonSet":
+		return workloadRef{Kind: owner.Kind, Namespace: pod.Namespace, Name: owner.Name}, true, nil
+	case "ReplicaSet":
+		return c.deploymentForPod(ctx, pod)
+	}
+
+	return workloadRef{}, false, nil
+}
+
+// getWorkload returns the metadata and pod template of a workload.
+func (c *Controller) getWorkload(ctx context.Context, ref workloadRef) (metav1.Object, *v1.PodTemplateSpec, error) {
+	apps := c.clientset.AppsV1()
+	switch ref.Kind {
+	case "Deployment":
+		d, err := c.getDeployment(ctx, ref.Namespace, ref.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return d, &d.Spec.Template, nil
+	case "StatefulSet":
+		sts, err := apps.StatefulSets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return sts, &sts.Spec.Template, nil
+	case "DaemonSet":
+		ds, err := apps.DaemonSets(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, nil, err
+		}
+		return ds, &ds.Spec.Template, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported workload kind %q", ref.Kind)
+}
+
+// restartWorkload patches the restartedAt annotation on the workload's pod
+// template, the same mechanism used by `kubectl rollout restart`, along with
+// the checksum of the ConfigMap content that triggered it.
+func (c *Controller) restartWorkload(ctx context.Context, ref workloadRef, checksum string) error {
+	patch, err := json.Marshal(map[string]any{
+		"spec": map[string]any{
+			"template": map[string]any{
+				"metadata": map[string]any{
+					"annotations": map[string]string{
+						restartedAtAnnotation: time.Now().Format(time.RFC3339),
+						checksumAnnotation:    checksum,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	apps := c.clientset.AppsV1()
+	opts := metav1.PatchOptions{FieldManager: c.opts.FieldManager}
+	switch ref.Kind {
+	case "Deployment":
+		_, err = apps.Deployments(ref.Namespace).Patch(ctx, ref.Name, types.StrategicMergePatchType, patch, opts)
+	case "StatefulSet":
+		_, err = apps.StatefulSets(ref.Namespace).Patch(ctx, ref.Name, types.StrategicMergePatchType, patch, opts)
+	case "DaemonSet":
+		_, err = apps.DaemonSets(ref.Namespace).Patch(ctx, ref.Name, types.StrategicMergePatchType, patch, opts)
+	}
+	return err
+}
+
+// usesEnv reports whether a container consumes the named ConfigMap through
+// envFrom or env.valueFrom. Like the index, it only looks at the containers
+// selected by -container-names.
+func (c *Controller) usesEnv(pod *v1.Pod, cmName string) bool {
+	for _, ref := range c.configMapReferences(pod) {
+		if ref.Name == cmName && (ref.Mechanism == refMechanismEnvFrom || ref.Mechanism == refMechanismEnvKeyRef) {
+			return true
+		}
+	}
+	return false
+}
+
+// podTerminated reports whether the pod has reached a terminal phase, which
+// its containers never leave.
+func podTerminated(pod *v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
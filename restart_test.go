@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// testDeployment returns a Deployment, its ReplicaSet and one of its Pods
+// with spec, in the default namespace.
+func testDeployment(name string, spec v1.PodSpec) (*appsv1.Deployment, *appsv1.ReplicaSet, *v1.Pod) {
+	deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+	deployment.Spec.Template.Spec = spec
+	rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name + "-abc"}}
+	controlledBy(rs, "Deployment", name)
+	pod := testPod(name+"-abc-1", spec)
+	controlledBy(pod, "ReplicaSet", rs.Name)
+	return deployment, rs, pod
+}
+
+// patchedWorkloads returns resource/name of every object patched through
+// clientset, in order.
+func patchedWorkloads(clientset *fake.Clientset) []string {
+	var patched []string
+	for _, action := range clientset.Actions() {
+		if patch, ok := action.(k8stesting.PatchAction); ok {
+			patched = append(patched, action.GetResource().Resource+"/"+patch.GetName())
+		}
+	}
+	return patched
+}
+
+func TestRestartWorkloads(t *testing.T) {
+	cm := testConfigMap("app-config", map[string]string{"level": "info"})
+	c := &Controller{}
+	checksum := c.restartChecksum(cm)
+
+	tests := []struct {
+		name    string
+		opts    Options
+		objs    func() ([]runtime.Object, *v1.Pod)
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "restarts Deployment of Pod",
+			opts: Options{EnableRestart: true, RestartDefault: true},
+			objs: func() ([]runtime.Object, *v1.Pod) {
+				d, rs, pod := testDeployment("web", volumeSpec("app-config"))
+				return []runtime.Object{d, rs}, pod
+			},
+			want: []string{"deployments/web"},
+		},
+		{
+			name: "workload opted out",
+			opts: Options{EnableRestart: true, RestartDefault: true},
+			objs: func() ([]runtime.Object, *v1.Pod) {
+				d, rs, pod := testDeployment("web", volumeSpec("app-config"))
+				d.Annotations = map[string]string{restartAnnotation: "false"}
+				return []runtime.Object{d, rs}, pod
+			},
+		},
+		{
+			name: "already at checksum",
+			opts: Options{EnableRestart: true, RestartDefault: true},
+			objs: func() ([]runtime.Object, *v1.Pod) {
+				d, rs, pod := testDeployment("web", volumeSpec("app-config"))
+				d.Spec.Template.Annotations = map[string]string{checksumAnnotation: checksum}
+				return []runtime.Object{d, rs}, pod
+			},
+		},
+		{
+			name: "dry run",
+			opts: Options{EnableRestart: true, RestartDefault: true, DryRun: true},
+			objs: func() ([]runtime.Object, *v1.Pod) {
+				d, rs, pod := testDeployment("web", volumeSpec("app-config"))
+				return []runtime.Object{d, rs}, pod
+			},
+		},
+		{
+			name: "Pod without controller",
+			opts: Options{EnableRestart: true, RestartDefault: true},
+			objs: func() ([]runtime.Object, *v1.Pod) {
+				return nil, testPod("standalone", volumeSpec("app-config"))
+			},
+		},
+		{
+			name: "missing Deployment",
+			opts: Options{EnableRestart: true, RestartDefault: true},
+			objs: func() ([]runtime.Object, *v1.Pod) {
+				_, rs, pod := testDeployment("web", volumeSpec("app-config"))
+				return []runtime.Object{rs}, pod
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objs, pod := tt.objs()
+			c, clientset := newTestController(t, tt.opts, objs...)
+
+			err := c.restartWorkloads(context.Background(), cm, []any{pod}, make(map[workloadRef]bool))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("restartWorkloads() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := patchedWorkloads(clientset); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("patched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestartWorkloadsSetsChecksum(t *testing.T) {
+	cm := testConfigMap("app-config", map[string]string{"level": "info"})
+	d, rs, pod := testDeployment("web", volumeSpec("app-config"))
+	c, clientset := newTestController(t, Options{EnableRestart: true, RestartDefault: true}, d, rs)
+
+	done := make(map[workloadRef]bool)
+	if err := c.restartWorkloads(context.Background(), cm, []any{pod}, done); err != nil {
+		t.Fatalf("restartWorkloads: %v", err)
+	}
+	if ref := (workloadRef{Kind: "Deployment", Namespace: "default", Name: "web"}); !done[ref] {
+		t.Errorf("done = %v, want %v recorded", done, ref)
+	}
+
+	got, err := clientset.AppsV1().Deployments("default").Get(context.Background(), "web", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting Deployment: %v", err)
+	}
+	annotations := got.Spec.Template.Annotations
+	if annotations[checksumAnnotation] != c.restartChecksum(cm) {
+		t.Errorf("checksum annotation = %q, want %q", annotations[checksumAnnotation], c.restartChecksum(cm))
+	}
+	if annotations[restartedAtAnnotation] == "" {
+		t.Errorf("restartedAt annotation not set")
+	}
+}
+
+func TestRestartCooldownDefers(t *testing.T) {
+	cm := testConfigMap("app-config", map[string]string{"level": "info"})
+	checksum := (&Controller{}).restartChecksum(cm)
+	ref := workloadRef{Kind: "Deployment", Namespace: "default", Name: "web"}
+
+	tests := []struct {
+		name            string
+		rolledOut       bool
+		wantPatchedLate []string
+	}{
+		{name: "restarted once the cooldown ends", wantPatchedLate: []string{"deployments/web"}},
+		{name: "rollout already picked up the change", rolledOut: true, wantPatchedLate: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, rs, pod := testDeployment("web", volumeSpec("app-config"))
+			c, clientset := newTestController(t, Options{EnableRestart: true, RestartDefault: true, RestartCooldown: time.Minute}, d, rs)
+
+			// Restarted for another ConfigMap 20 seconds ago
+			c.restartCooldowns[ref] = time.Now().Add(-20 * time.Second)
+			done := make(map[workloadRef]bool)
+			err := c.restartWorkloads(context.Background(), cm, []any{pod}, done)
+			var deferred *restartsDeferredError
+			if !errors.As(err, &deferred) || deferred.Reason != "restart cooldown" {
+				t.Fatalf("restartWorkloads() = %v, want a restart cooldown deferral", err)
+			}
+			if deferred.RetryAfter <= 30*time.Second || deferred.RetryAfter > 40*time.Second {
+				t.Errorf("RetryAfter = %s, want the remaining 40s", deferred.RetryAfter)
+			}
+			if done[ref] {
+				t.Errorf("workload recorded as done while its restart is deferred")
+			}
+			if got := patchedWorkloads(clientset); len(got) != 0 {
+				t.Fatalf("patched %v during the cooldown, want none", got)
+			}
+
+			if tt.rolledOut {
+				d.Spec.Template.Annotations = map[string]string{checksumAnnotation: checksum}
+				if _, err := clientset.AppsV1().Deployments("default").Update(context.Background(), d, metav1.UpdateOptions{}); err != nil {
+					t.Fatalf("updating Deployment: %v", err)
+				}
+			}
+			c.restartCooldowns[ref] = time.Now().Add(-2 * time.Minute)
+			if err := c.restartWorkloads(context.Background(), cm, []any{pod}, done); err != nil {
+				t.Fatalf("restartWorkloads after the cooldown: %v", err)
+			}
+			if got := patchedWorkloads(clientset); !reflect.DeepEqual(got, tt.wantPatchedLate) {
+				t.Errorf("patched %v after the cooldown, want %v", got, tt.wantPatchedLate)
+			}
+			if !done[ref] {
+				t.Errorf("workload not recorded as done after the cooldown")
+			}
+		})
+	}
+}
+
+func TestRestartWorkloadsOwnerKinds(t *testing.T) {
+	tests := []struct {
+		name string
+		objs func() ([]runtime.Object, *v1.Pod)
+		want workloadRef
+	}{
+		{
+			name: "Deployment through ReplicaSet",
+			objs: func() ([]runtime.Object, *v1.Pod) {
+				d, rs, pod := testDeployment("web", volumeSpec("app-config"))
+				return []runtime.Object{d, rs}, pod
+			},
+			want: workloadRef{Kind: "Deployment", Namespace: "default", Name: "web"},
+		},
+		{
+			name: "StatefulSet",
+			objs: func() ([]runtime.Object, *v1.Pod) {
+				sts := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db"}}
+				pod := testPod("db-0", volumeSpec("app-config"))
+				controlledBy(pod, "StatefulSet", "db")
+				return []runtime.Object{sts}, pod
+			},
+			want: workloadRef{Kind: "StatefulSet", Namespace: "default", Name: "db"},
+		},
+		{
+			name: "DaemonSet",
+			objs: func() ([]runtime.Object, *v1.Pod) {
+				ds := &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "agent"}}
+				pod := testPod("agent-x1", volumeSpec("app-config"))
+				controlledBy(pod, "DaemonSet", "agent")
+				return []runtime.Object{ds}, pod
+			},
+			want: workloadRef{Kind: "DaemonSet", Namespace: "default", Name: "agent"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := testConfigMap("app-config", map[string]string{"level": "info"})
+			objs, pod := tt.objs()
+			c, clientset := newTestController(t, Options{EnableRestart: true, RestartDefault: true}, objs...)
+			ctx := context.Background()
+
+			ref, ok, err := c.resolveWorkload(ctx, pod)
+			if err != nil || !ok || ref != tt.want {
+				t.Fatalf("resolveWorkload() = %v, %v, %v, want %v", ref, ok, err, tt.want)
+			}
+			if err := c.restartWorkloads(ctx, cm, []any{pod}, make(map[workloadRef]bool)); err != nil {
+				t.Fatalf("restartWorkloads: %v", err)
+			}
+			resource := strings.ToLower(tt.want.Kind) + "s/" + tt.want.Name
+			if got := patchedWorkloads(clientset); !reflect.DeepEqual(got, []string{resource}) {
+				t.Fatalf("patched %v, want [%s]", got, resource)
+			}
+			_, template, err := c.getWorkload(ctx, tt.want)
+			if err != nil {
+				t.Fatalf("getWorkload: %v", err)
+			}
+			if got := template.Annotations; got[checksumAnnotation] != c.restartChecksum(cm) || got[restartedAtAnnotation] == "" {
+				t.Errorf("template annotations = %v, want checksum %s and restartedAt", got, c.restartChecksum(cm))
+			}
+		})
+	}
+}
+
+func TestPodTerminated(t *testing.T) {
+	tests := []struct {
+		phase v1.PodPhase
+		want  bool
+	}{
+		{phase: v1.PodPending, want: false},
+		{phase: v1.PodRunning, want: false},
+		{phase: v1.PodUnknown, want: false},
+		{phase: v1.PodSucceeded, want: true},
+		{phase: v1.PodFailed, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.phase), func(t *testing.T) {
+			pod := testPod("web", v1.PodSpec{})
+			pod.Status.Phase = tt.phase
+			if got := podTerminated(pod); got != tt.want {
+				t.Errorf("podTerminated() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerminatedPodsListedButNotRestarted(t *testing.T) {
+	cm := testConfigMap("app-config", map[string]string{"level": "info"})
+	d, rs, pod := testDeployment("web", volumeSpec("app-config"))
+	pod.Status.Phase = v1.PodSucceeded
+	c, clientset := newTestController(t, Options{EnableRestart: true, RestartDefault: true}, cm, d, rs, pod)
+	startTestInformers(t, c)
+
+	refs, _, err := c.configMapPods("default/app-config")
+	if err != nil {
+		t.Fatalf("configMapPods: %v", err)
+	}
+	if want := []objectRef{{Namespace: "default", Name: pod.Name}}; !reflect.DeepEqual(refs, want) {
+		t.Errorf("configMapPods() = %v, want %v", refs, want)
+	}
+
+	if err := c.reconcileConfigMap(context.Background(), "default/app-config", "id", nil, false); err != nil {
+		t.Fatalf("reconcileConfigMap: %v", err)
+	}
+	if got := patchedWorkloads(clientset); len(got) != 0 {
+		t.Errorf("patched %v for a completed Pod, want none", got)
+	}
+}
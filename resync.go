@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+var errResyncNotSynced = errors.New("caches are still syncing")
+
+// resyncAll queues every handled ConfigMap for a reconcile through the
+// workers, as an operator-triggered alternative to periodic resyncs. Keys
+// already queued are not duplicated, so it is safe to call at any time.
+// Since nothing changed, the reconciles only report and restart no
+// workload, except for ConfigMaps with an update already pending. Each
+// reconcile is delayed by a random amount up to ResyncJitter, while updates
+// keep going through the debounce window alone. ConfigMaps over
+// -max-queue-depth are shed. It returns the number of
+// ConfigMaps queued, and errResyncNotSynced before the caches have synced,
+// which includes standby replicas.
+func (c *Controller) resyncAll(source string) (int, error) {
+	if !c.cachesSynced.Load() {
+		return 0, errResyncNotSynced
+	}
+
+	queued, shed := 0, 0
+	for _, obj := range c.configMapInformer.GetStore().List() {
+		cm, ok := obj.(*v1.ConfigMap)
+		if !ok || c.ignoredNamespaces[cm.Namespace] || configMapIgnored(cm) {
+			continue
+		}
+		if _, owned := c.configMapOwnerIgnored(cm); owned {
+			continue
+		}
+		key := cm.Namespace + "/" + cm.Name
+		if !c.watchListAllows(key) || !c.configMapReferenced(key) {
+			continue
+		}
+		if c.shedWork("configmap", "resync") {
+			shed++
+			continue
+		}
+		c.markResyncOnly(key)
+		// Spread the reconciles out instead of running them all at once
+		if c.opts.ResyncJitter > 0 {
+			c.queue.AddAfter(key, rand.N(c.opts.ResyncJitter))
+		} else {
+			c.queue.Add(key)
+		}
+		queued++
+	}
+	slog.Info("Resync requested, queued every ConfigMap for reconcile", "source", source, "count", queued, "shed", shed)
+	return queued, nil
+}
+
+// watchResyncSignal runs resyncAll on every SIGUSR1 until stopCh is closed.
+func (c *Controller) watchResyncSignal(stopCh <-chan struct{}) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-sigCh:
+			if _, err := c.resyncAll("signal"); err != nil {
+				slog.Warn("SIGUSR1 received but resync is not possible yet", "err", err)
+			}
+		}
+	}
+}
+
+// handleResync runs resyncAll for POST /resync and reports how many
+// ConfigMaps were queued. Since it triggers work on the cluster, it is only
+// served with -api-token-file, behind requireConfiguredToken.
+func (c *Controller) handleResync(w http.ResponseWriter, r *http.Request) {
+	queued, err := c.resyncAll("http")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	// The reconciles run asynchronously in the workers
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, map[string]int{"queued": queued})
+}
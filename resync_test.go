@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestResyncAllJitter(t *testing.T) {
+	const jitter = 200 * time.Millisecond
+
+	tests := []struct {
+		name   string
+		jitter time.Duration
+		// wantQueued is the queue length right after the resync and one
+		// update of a-config.
+		wantQueued int
+	}{
+		{name: "without jitter", wantQueued: 3},
+		{name: "with jitter only the update is queued", jitter: jitter, wantQueued: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := testConfigMap("a-config", map[string]string{"a": "1"})
+			objs := []runtime.Object{
+				cm,
+				testConfigMap("b-config", map[string]string{"b": "1"}),
+				testConfigMap("c-config", map[string]string{"c": "1"}),
+			}
+			c, _ := newTestController(t, Options{WatchData: true, ResyncJitter: tt.jitter}, objs...)
+			startTestInformers(t, c)
+			c.cachesSynced.Store(true)
+
+			queued, err := c.resyncAll("test")
+			if err != nil || queued != 3 {
+				t.Fatalf("resyncAll() = %d, %v, want 3", queued, err)
+			}
+			updated := cm.DeepCopy()
+			updated.ResourceVersion = "2"
+			updated.Data = map[string]string{"a": "2"}
+			c.onConfigMapUpdate(cm, updated)
+			if n := c.queue.Len(); n != tt.wantQueued {
+				t.Errorf("queue length right after the resync and an update = %d, want %d", n, tt.wantQueued)
+			}
+
+			deadline := time.Now().Add(jitter + 5*time.Second)
+			for c.queue.Len() < 3 && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if n := c.queue.Len(); n != 3 {
+				t.Errorf("queue length once the jitter elapsed = %d, want 3", n)
+			}
+			if c.takeResyncOnly("default/a-config") {
+				t.Errorf("updated ConfigMap still marked resync-only")
+			}
+			if !c.takeResyncOnly("default/b-config") {
+				t.Errorf("resynced ConfigMap not marked resync-only")
+			}
+		})
+	}
+}
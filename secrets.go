@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func (c *Controller) onSecretAdd(obj any) {
+	secret, ok := obj.(*v1.Secret)
+	if !ok || secret == nil {
+		warnUnexpectedObject("Secret", "add", obj)
+		return
+	}
+	if c.ignoredNamespaces[secret.Namespace] {
+		return
+	}
+	secretEvents.WithLabelValues("add").Inc()
+	slog.Info("Secret added", "event", "add", "kind", "Secret", "namespace", secret.Namespace, "name", secret.Name)
+}
+
+func (c *Controller) onSecretUpdate(oldObj, newObj any) {
+	oldSecret, ok := oldObj.(*v1.Secret)
+	if !ok || oldSecret == nil {
+		warnUnexpectedObject("Secret", "update", oldObj)
+		return
+	}
+	secret, ok := newObj.(*v1.Secret)
+	if !ok || secret == nil {
+		warnUnexpectedObject("Secret", "update", newObj)
+		return
+	}
+	if c.ignoredNamespaces[secret.Namespace] {
+		return
+	}
+	secretEvents.WithLabelValues("update").Inc()
+
+	// Skip resyncs and metadata-only changes
+	if secretContentEqual(oldSecret, secret) {
+		return
+	}
+
+	slog.Info("Secret updated", "event", "update", "kind", "Secret", "namespace", secret.Namespace, "name", secret.Name)
+
+	key := secret.Namespace + "/" + secret.Name
+	pods, err := c.podInformer.GetIndexer().ByIndex("secretRef", key)
+	if err != nil {
+		slog.Error("Error fetching pods from index", "kind", "Secret", "namespace", secret.Namespace, "name", secret.Name, "err", err)
+		return
+	}
+
+	slog.Info("Found Pods using Secret", "kind", "Secret", "namespace", secret.Namespace, "name", secret.Name, "count", len(pods))
+	c.logReferencingPods(context.Background(), pods, "Secret", "secret", key, c.cachedWorkload, nil)
+}
+
+func secretContentEqual(a, b *v1.Secret) bool {
+	if len(a.Data) != 0 || len(b.Data) != 0 {
+		if !reflect.DeepEqual(a.Data, b.Data) {
+			return false
+		}
+	}
+	return reflect.DeepEqual(a.Immutable, b.Immutable)
+}
+
+func (c *Controller) onSecretDelete(obj any) {
+	var secret *v1.Secret
+	switch obj := obj.(type) {
+	case *v1.Secret:
+		secret = obj
+	case cache.DeletedFinalStateUnknown:
+		secret, _ = obj.Obj.(*v1.Secret)
+	}
+	if secret == nil {
+		warnUnexpectedObject("Secret", "delete", obj)
+		return
+	}
+	if c.ignoredNamespaces[secret.Namespace] {
+		return
+	}
+	secretEvents.WithLabelValues("delete").Inc()
+	slog.Info("Secret deleted", "event", "delete", "kind", "Secret", "namespace", secret.Namespace, "name", secret.Name)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// serveHTTP starts the metrics, health and query API server and shuts it
+// down once stopCh is closed. It fails if MetricsAddr cannot be listened on.
+func (c *Controller) serveHTTP(stopCh <-chan struct{}) error {
+	addr := c.opts.MetricsAddr
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening on -metrics-addr %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", c.handleReadyz)
+	mux.HandleFunc("POST /resync", c.requireConfiguredToken(c.handleResync))
+	c.registerAPI(mux)
+	if c.opts.EnablePprof {
+		registerPprof(mux)
+	}
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	if c.certs != nil {
+		srv.TLSConfig = c.tlsConfig()
+		go c.certs.watch(stopCh)
+	}
+	if c.apiToken != nil {
+		go c.apiToken.watch(stopCh)
+	}
+
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Error("Error shutting down HTTP server", "err", err)
+		}
+	}()
+
+	go func() {
+		slog.Info("Serving metrics, health checks and API", "addr", addr, "tls", c.certs != nil)
+		var err error
+		if c.certs != nil {
+			// The certificate comes from TLSConfig.GetCertificate
+			err = srv.ServeTLS(lis, "", "")
+		} else {
+			err = srv.Serve(lis)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("HTTP server failed", "err", err)
+		}
+	}()
+	return nil
+}
+
+// registerPprof serves the runtime profiles under /debug/pprof/ on mux.
+// Importing net/http/pprof also registers them on http.DefaultServeMux,
+// which is never served.
+func registerPprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
+
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// handleReadyz reports whether the caches have synced and every watch is
+// healthy. A standby replica has no caches to sync and is ready as long as
+// it runs, so it never holds up a rolling update; its query API still
+// answers 503.
+func (c *Controller) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if c.standby.Load() {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok, standby\n"))
+		return
+	}
+	if !c.apiReady() {
+		http.Error(w, "caches are still syncing", http.StatusServiceUnavailable)
+		return
+	}
+	if failing := c.failingWatches(); len(failing) > 0 {
+		http.Error(w, "watches failing for "+strings.Join(failing, ", "), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
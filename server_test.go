@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEndpointsWaitForPodIndexes(t *testing.T) {
+	c, _ := newTestController(t, Options{}, testConfigMap("app-config", nil), testPod("web", volumeSpec("app-config")))
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", c.handleReadyz)
+	c.registerAPI(mux)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	paths := []string{"/readyz", "/configmaps/default/app-config/pods"}
+
+	for _, path := range paths {
+		if rec := get(path); rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("GET %s before sync = %d, want %d", path, rec.Code, http.StatusServiceUnavailable)
+		}
+	}
+
+	// Synced caches alone are not enough until the Pod indexes are checked
+	startTestInformers(t, c)
+	c.cachesSynced.Store(true)
+	for _, path := range paths {
+		if rec := get(path); rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("GET %s before the Pod indexes are ready = %d, want %d", path, rec.Code, http.StatusServiceUnavailable)
+		}
+	}
+
+	if err := c.checkPodIndexes(); err != nil {
+		t.Fatalf("checkPodIndexes: %v", err)
+	}
+	c.podIndexesReady.Store(true)
+	for _, path := range paths {
+		if rec := get(path); rec.Code != http.StatusOK {
+			t.Errorf("GET %s after sync = %d, want %d", path, rec.Code, http.StatusOK)
+		}
+	}
+	if body := get("/configmaps/default/app-config/pods").Body.String(); !strings.Contains(body, `"web"`) {
+		t.Errorf("pods of app-config = %s, want web listed", body)
+	}
+}
+
+func TestResyncEndpointRequiresTokenFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		apiTokenFile  string
+		authorization string
+		want          int
+	}{
+		{name: "without token file", want: http.StatusForbidden},
+		{name: "without token file but with header", authorization: "Bearer s3cret", want: http.StatusForbidden},
+		{name: "missing token", apiTokenFile: tokenFile, want: http.StatusUnauthorized},
+		{name: "wrong token", apiTokenFile: tokenFile, authorization: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "valid token", apiTokenFile: tokenFile, authorization: "Bearer s3cret", want: http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := newTestController(t, Options{APITokenFile: tt.apiTokenFile}, testConfigMap("app-config", nil))
+			startTestInformers(t, c)
+			c.cachesSynced.Store(true)
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /resync", c.requireConfiguredToken(c.handleResync))
+
+			req := httptest.NewRequest(http.MethodPost, "/resync", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("POST /resync = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
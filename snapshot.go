@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".json"
+	// snapshotTimeFormat sorts lexically in time order.
+	snapshotTimeFormat = "20060102T150405Z"
+)
+
+// snapshot is the content of a reference graph snapshot file.
+type snapshot struct {
+	Time       time.Time            `json:"time"`
+	ConfigMaps []configMapPodsEntry `json:"configMaps"`
+}
+
+// writeSnapshots writes a reference graph snapshot to SnapshotDir right away
+// and then every SnapshotInterval until stopCh is closed. Failures are logged
+// and retried at the next interval.
+func (c *Controller) writeSnapshots(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(c.opts.SnapshotInterval)
+	defer ticker.Stop()
+	for {
+		if err := c.writeSnapshot(time.Now()); err != nil {
+			slog.Error("Error writing reference graph snapshot", "dir", c.opts.SnapshotDir, "err", err)
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeSnapshot writes the snapshot taken at now to a temporary file and
+// renames it into place, so readers never see a partial file, then removes
+// all but the newest SnapshotKeep snapshots.
+func (c *Controller) writeSnapshot(now time.Time) error {
+	entries, err := c.referenceGraph()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(snapshot{Time: now.UTC(), ConfigMaps: entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+
+	dir := c.opts.SnapshotDir
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".snapshot-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, snapshotPrefix+now.UTC().Format(snapshotTimeFormat)+snapshotSuffix)
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	slog.Info("Wrote reference graph snapshot", "path", path, "configMaps", len(entries))
+
+	return pruneSnapshots(dir, c.opts.SnapshotKeep)
+}
+
+// pruneSnapshots removes all but the newest keep snapshots in dir.
+func pruneSnapshots(dir string, keep int) error {
+	paths, err := filepath.Glob(filepath.Join(dir, snapshotPrefix+"*"+snapshotSuffix))
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+	for len(paths) > keep {
+		if err := os.Remove(paths[0]); err != nil {
+			return err
+		}
+		slog.Debug("Removed old reference graph snapshot", "path", paths[0])
+		paths = paths[1:]
+	}
+	return nil
+}
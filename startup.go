@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"syscall"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	apiversion "k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// connect creates a clientset and checks that the API server answers,
+// retrying with exponential backoff until timeout elapses. Only errors that
+// retryableConnectError accepts are retried; anything else, such as an
+// invalid config, an untrusted certificate or rejected credentials, fails
+// immediately.
+func connect(cfg *rest.Config, timeout time.Duration) (*kubernetes.Clientset, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	backoff := wait.Backoff{
+		Duration: 500 * time.Millisecond,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    math.MaxInt32,
+		Cap:      10 * time.Second,
+	}
+
+	var (
+		cs      *kubernetes.Clientset
+		lastErr error
+	)
+	err := wait.ExponentialBackoffWithContext(ctx, backoff, func(ctx context.Context) (bool, error) {
+		c, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			return false, fmt.Errorf("creating clientset: %w", err)
+		}
+
+		info, err := serverVersion(ctx, c)
+		if err != nil {
+			if !retryableConnectError(err) {
+				return false, fmt.Errorf("checking API server connectivity: %w", err)
+			}
+			lastErr = fmt.Errorf("checking API server connectivity: %w", err)
+			slog.Warn("API server not reachable yet, retrying", "host", cfg.Host, "err", err)
+			return false, nil
+		}
+
+		slog.Info("Connected to API server", "host", cfg.Host, "version", info.GitVersion)
+		cs = c
+		return true, nil
+	})
+	if err != nil {
+		if lastErr != nil && wait.Interrupted(err) {
+			return nil, fmt.Errorf("giving up after %s: %w", timeout, lastErr)
+		}
+		return nil, err
+	}
+	return cs, nil
+}
+
+// retryableConnectError reports whether err is a transient failure to reach
+// the API server: a refused, reset or unreachable connection, a DNS failure,
+// a timeout, or an API server that is up but temporarily unable to serve.
+func retryableConnectError(err error) bool {
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.EHOSTUNREACH),
+		errors.Is(err, syscall.ENETUNREACH),
+		errors.Is(err, context.DeadlineExceeded):
+		return true
+	case apierrors.IsServerTimeout(err),
+		apierrors.IsTimeout(err),
+		apierrors.IsTooManyRequests(err),
+		apierrors.IsServiceUnavailable(err),
+		apierrors.IsInternalError(err):
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	// *url.Error also implements net.Error, so only its Timeout is trusted
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// serverVersion is Discovery().ServerVersion() bounded by ctx.
+func serverVersion(ctx context.Context, c *kubernetes.Clientset) (*apiversion.Info, error) {
+	body, err := c.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Raw()
+	if err != nil {
+		return nil, err
+	}
+	var info apiversion.Info
+	if err := json.Unmarshal(body, &info); err != nil {
+		return nil, fmt.Errorf("decoding server version: %w", err)
+	}
+	return &info, nil
+}
+
+// checkPodAccess lists a single Pod in namespace to fail fast, with a hint,
+// when the service account may not list Pods; without that the informer
+// would retry forever and caches would never sync. Other errors are left to
+// the informer.
+func checkPodAccess(ctx context.Context, cs kubernetes.Interface, namespace string) error {
+	_, err := cs.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{Limit: 1})
+	if apierrors.IsForbidden(err) {
+		return fmt.Errorf("listing Pods is forbidden; grant list and watch on pods to the service account, or pass -configmap-only to only log ConfigMap changes: %w", err)
+	}
+	return nil
+}
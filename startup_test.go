@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// roundTripperFunc adapts a function to http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// connectionRefused is the error a dial to a closed port fails with.
+var connectionRefused = &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+
+// jsonResponse returns a response with status code and JSON body.
+func jsonResponse(code int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: code,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestConnect(t *testing.T) {
+	unauthorized := func() *http.Response {
+		return jsonResponse(http.StatusUnauthorized, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"Unauthorized","code":401}`)
+	}
+	version := func() *http.Response { return jsonResponse(http.StatusOK, `{"gitVersion":"v1.33.3"}`) }
+
+	tests := []struct {
+		name      string
+		responses []func() (*http.Response, error)
+		timeout   time.Duration
+		wantErr   func(error) bool
+		wantCalls int32
+	}{
+		{
+			name:      "connected",
+			responses: []func() (*http.Response, error){func() (*http.Response, error) { return version(), nil }},
+			timeout:   5 * time.Second,
+			wantCalls: 1,
+		},
+		{
+			name: "connection refused then connected",
+			responses: []func() (*http.Response, error){
+				func() (*http.Response, error) { return nil, connectionRefused },
+				func() (*http.Response, error) { return version(), nil },
+			},
+			timeout:   5 * time.Second,
+			wantCalls: 2,
+		},
+		{
+			name:      "unauthorized fails without retry",
+			responses: []func() (*http.Response, error){func() (*http.Response, error) { return unauthorized(), nil }},
+			timeout:   5 * time.Second,
+			wantErr:   apierrors.IsUnauthorized,
+			wantCalls: 1,
+		},
+		{
+			name:      "connection refused until timeout",
+			responses: []func() (*http.Response, error){func() (*http.Response, error) { return nil, connectionRefused }},
+			timeout:   300 * time.Millisecond,
+			wantErr: func(err error) bool {
+				return errors.Is(err, syscall.ECONNREFUSED) && strings.Contains(err.Error(), "giving up after 300ms")
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			cfg := &rest.Config{
+				Host: "https://api.example.com",
+				Transport: roundTripperFunc(func(*http.Request) (*http.Response, error) {
+					n := int(calls.Add(1))
+					return tt.responses[min(n, len(tt.responses))-1]()
+				}),
+			}
+
+			_, err := connect(cfg, tt.timeout)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("connect() = %v, want nil", err)
+			}
+			if tt.wantErr != nil && (err == nil || !tt.wantErr(err)) {
+				t.Fatalf("connect() = %v, want a different error", err)
+			}
+			if tt.wantCalls > 0 && calls.Load() != tt.wantCalls {
+				t.Errorf("API server called %d times, want %d", calls.Load(), tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryableConnectError(t *testing.T) {
+	gr := schema.GroupResource{Resource: "version"}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "connection refused", err: &url.Error{Op: "Get", URL: "https://api", Err: connectionRefused}, want: true},
+		{name: "DNS failure", err: &url.Error{Op: "Get", URL: "https://api", Err: &net.DNSError{Err: "no such host", Name: "api"}}, want: true},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: true},
+		{name: "service unavailable", err: apierrors.NewServiceUnavailable("starting"), want: true},
+		{name: "too many requests", err: apierrors.NewTooManyRequests("slow down", 1), want: true},
+		{name: "unauthorized", err: apierrors.NewUnauthorized("bad token"), want: false},
+		{name: "forbidden", err: apierrors.NewForbidden(gr, "", errors.New("denied")), want: false},
+		{name: "untrusted certificate", err: &url.Error{Op: "Get", URL: "https://api", Err: x509.UnknownAuthorityError{}}, want: false},
+		{name: "other", err: errors.New("invalid configuration"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryableConnectError(tt.err); got != tt.want {
+				t.Errorf("retryableConnectError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
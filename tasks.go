@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// taskKind names the follow-up work an event handler leaves to the task
+// worker.
+type taskKind string
+
+const (
+	// taskCrashLoop checks whether the Pod stored under the key is
+	// crash-looping after a ConfigMap-triggered restart.
+	taskCrashLoop taskKind = "crashLoop"
+	// taskConfigMapDeleted warns about the Pods still referencing the
+	// deleted ConfigMap stored under the key.
+	taskConfigMapDeleted taskKind = "configMapDeleted"
+	// taskConfigMapCreated reports the Pods already referencing the created
+	// ConfigMap stored under the key.
+	taskConfigMapCreated taskKind = "configMapCreated"
+	// taskRestartStuckPod deletes the Pod stored under the key, stuck
+	// waiting for the created ConfigMap stored under ConfigMap.
+	taskRestartStuckPod taskKind = "restartStuckPod"
+)
+
+// task is follow-up work of an event handler that may call the API server.
+// Handlers queue it so informer event delivery never waits on the API
+// server, and the task worker runs it with its own context and retries.
+// Key is the store key of the object the task concerns, which is read back
+// from the cache when the task runs, and ConfigMap the key of the ConfigMap
+// that caused it, when that is not the object itself.
+type task struct {
+	Kind      taskKind
+	Key       string
+	ConfigMap string
+}
+
+func (c *Controller) runTaskWorker(ctx context.Context) {
+	for c.processNextTask(ctx) {
+	}
+}
+
+func (c *Controller) processNextTask(ctx context.Context) bool {
+	t, quit := c.tasks.Get()
+	if quit {
+		return false
+	}
+	defer c.tasks.Done(t)
+
+	err := c.runTask(ctx, t)
+	var deferred *restartsDeferredError
+	switch {
+	case err == nil:
+		c.tasks.Forget(t)
+	case errors.As(err, &deferred):
+		c.tasks.AddAfter(t, deferred.RetryAfter)
+	case c.tasks.NumRequeues(t) < maxRetries:
+		slog.Warn("Error running task, retrying", "task", t.Kind, "key", t.Key, "err", err)
+		c.tasks.AddRateLimited(t)
+	default:
+		c.tasks.Forget(t)
+		slog.Error("Dropping task out of the queue", "task", t.Kind, "key", t.Key, "retries", maxRetries, "err", err)
+	}
+	return true
+}
+
+// runTask runs t against the current cache contents. Tasks about objects
+// that are gone by then are dropped.
+func (c *Controller) runTask(ctx context.Context, t task) error {
+	switch t.Kind {
+	case taskCrashLoop:
+		obj, exists, err := c.podInformer.GetIndexer().GetByKey(t.Key)
+		if err != nil {
+			return fmt.Errorf("fetching Pod %s from store: %w", t.Key, err)
+		}
+		if pod, ok := obj.(*v1.Pod); exists && ok {
+			return c.checkCrashLoop(ctx, pod)
+		}
+		return nil
+	case taskConfigMapDeleted:
+		return c.warnReferencedConfigMapDeleted(ctx, t.Key)
+	case taskConfigMapCreated:
+		return c.checkDanglingReferences(t.Key)
+	case taskRestartStuckPod:
+		return c.restartStuckPod(ctx, t.Key, t.ConfigMap)
+	}
+	return fmt.Errorf("unknown task kind %q", t.Kind)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+)
+
+// tlsVersions maps the values accepted by -tls-min-version to their
+// crypto/tls constants.
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certReloader serves the certificate from -tls-cert-file and -tls-key-file
+// and swaps in a new one when the files change, so rotated certificates are
+// picked up without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     atomic.Pointer[tls.Certificate]
+}
+
+// newCertReloader loads the key pair, failing if it cannot be used.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload loads the key pair and swaps it in.
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("loading TLS key pair: %w", err)
+	}
+	r.cert.Store(&cert)
+	slog.Info("Loaded TLS certificate", "certFile", r.certFile, "keyFile", r.keyFile)
+	return nil
+}
+
+// getCertificate backs tls.Config.GetCertificate.
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// watch reloads the key pair whenever either file changes until stopCh is
+// closed. The certificate and key are rarely written at once, so a pair
+// that does not match yet keeps the previous certificate until the next
+// change.
+func (r *certReloader) watch(stopCh <-chan struct{}) {
+	watchFiles(stopCh, "TLS certificate", []string{r.certFile, r.keyFile}, r.reload)
+}
+
+// tlsConfig returns the TLS configuration of the HTTP and gRPC servers,
+// serving the certificate from certs.
+func (c *Controller) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     c.opts.TLSMinVersion,
+		GetCertificate: c.certs.getCertificate,
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+)
+
+// watchErrorState tracks the consecutive watch errors of one informer.
+type watchErrorState struct {
+	informer        cache.SharedIndexInformer
+	consecutive     int
+	resourceVersion string
+}
+
+// setWatchErrorHandler registers a handler logging and counting watch
+// failures of informer. It must be called before the informer starts.
+func (c *Controller) setWatchErrorHandler(resource string, informer cache.SharedIndexInformer) error {
+	c.watchErrorStatesMu.Lock()
+	c.watchErrorStates[resource] = &watchErrorState{informer: informer}
+	c.watchErrorStatesMu.Unlock()
+
+	return informer.SetWatchErrorHandler(func(r *cache.Reflector, err error) {
+		// A closed watch is routine and retried immediately
+		if errors.Is(err, io.EOF) {
+			return
+		}
+
+		watchErrors.WithLabelValues(resource).Inc()
+		consecutive := c.recordWatchError(resource)
+
+		args := []any{"resource", resource, "consecutive", consecutive, "err", err}
+		if apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err) {
+			args = append(args, "hint", "check the service account's RBAC permissions")
+		}
+		slog.Error("Watch failed", args...)
+	})
+}
+
+// recordWatchError bumps the consecutive error count of resource, resetting it
+// first if the informer has synced a newer resource version since the last
+// error.
+func (c *Controller) recordWatchError(resource string) int {
+	c.watchErrorStatesMu.Lock()
+	defer c.watchErrorStatesMu.Unlock()
+
+	state := c.watchErrorStates[resource]
+	rv := state.informer.LastSyncResourceVersion()
+	if rv != state.resourceVersion {
+		state.consecutive = 0
+		state.resourceVersion = rv
+	}
+	state.consecutive++
+	return state.consecutive
+}
+
+// failingWatches returns the resources whose watch errors have persisted
+// beyond the watch error threshold without the informer making progress.
+func (c *Controller) failingWatches() []string {
+	c.watchErrorStatesMu.Lock()
+	defer c.watchErrorStatesMu.Unlock()
+
+	var failing []string
+	for resource, state := range c.watchErrorStates {
+		if state.consecutive >= c.opts.WatchErrorThreshold && state.informer.LastSyncResourceVersion() == state.resourceVersion {
+			failing = append(failing, resource)
+		}
+	}
+	return failing
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"sigs.k8s.io/yaml"
+)
+
+// watchListEntry is one ConfigMap in the -watch-list file.
+type watchListEntry struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// loadWatchList reads a YAML or JSON list of watchListEntry from path and
+// returns the set of their namespace/name keys.
+func loadWatchList(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []watchListEntry
+	if err := yaml.UnmarshalStrict(data, &entries); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	keys := make(map[string]bool, len(entries))
+	var errs []error
+	for i, e := range entries {
+		if e.Namespace == "" || e.Name == "" {
+			errs = append(errs, fmt.Errorf("entry %d: namespace and name are required", i))
+			continue
+		}
+		keys[e.Namespace+"/"+e.Name] = true
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// watchListAllows reports whether the ConfigMap stored under key is handled.
+// Without -watch-list every ConfigMap is.
+func (c *Controller) watchListAllows(key string) bool {
+	keys := c.watchList.Load()
+	return keys == nil || (*keys)[key]
+}
+
+// reloadWatchList loads the -watch-list file and swaps it in.
+func (c *Controller) reloadWatchList() error {
+	keys, err := loadWatchList(c.opts.WatchListFile)
+	if err != nil {
+		return err
+	}
+	c.watchList.Store(&keys)
+	slog.Info("Loaded ConfigMap watch list", "path", c.opts.WatchListFile, "entries", len(keys))
+	return nil
+}
+
+// watchWatchListFile reloads the -watch-list file whenever it changes until
+// stopCh is closed. A file that fails to load keeps the previous list.
+func (c *Controller) watchWatchListFile(stopCh <-chan struct{}) {
+	watchFiles(stopCh, "watch list", []string{c.opts.WatchListFile}, c.reloadWatchList)
+}
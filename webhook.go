@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// webhookAttempts is the number of times a notification is sent before
+	// giving up on a 5xx response or transport error.
+	webhookAttempts = 5
+	// webhookBackoff is the delay before the first retry, doubled for each
+	// further one.
+	webhookBackoff = time.Second
+)
+
+type webhookPayload struct {
+	ConfigMap       objectRef   `json:"configmap"`
+	ChangedKeys     []string    `json:"changedKeys"`
+	ReferencingPods []objectRef `json:"referencingPods"`
+	// AffectedPods are the referencing Pods consuming a changed key, or
+	// all of them when the changed keys are unknown.
+	AffectedPods []objectRef `json:"affectedPods"`
+}
+
+// webhookDelivery is one notification waiting to be sent.
+type webhookDelivery struct {
+	url  string
+	body []byte
+	// attempt counts the sends so far.
+	attempt int
+	// logger carries the attributes of the reconcile that queued it.
+	logger *slog.Logger
+}
+
+// webhookNotifier sends notifications in the background so that a slow or
+// failing endpoint never blocks reconciles. Deliveries wait in a bounded
+// queue, failed ones are requeued with exponential backoff, and those that
+// cannot be delivered are logged in full as dead letters.
+type webhookNotifier struct {
+	client *http.Client
+	queue  chan webhookDelivery
+
+	// mu guards stopped, so no delivery is queued after run returns, and
+	// the deliveries waiting out their backoff, keyed by retry ID.
+	mu        sync.Mutex
+	stopped   bool
+	retrying  map[int]webhookDelivery
+	nextRetry int
+}
+
+func newWebhookNotifier(client *http.Client, size int) *webhookNotifier {
+	return &webhookNotifier{
+		client:   client,
+		queue:    make(chan webhookDelivery, size),
+		retrying: make(map[int]webhookDelivery),
+	}
+}
+
+// notify queues payload to be POSTed as JSON to url.
+func (n *webhookNotifier) notify(logger *slog.Logger, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	n.enqueue(webhookDelivery{url: url, body: body, logger: logger})
+	return nil
+}
+
+// enqueue queues d, dead-lettering it when the queue is full or the
+// notifier has stopped.
+func (n *webhookNotifier) enqueue(d webhookDelivery) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.enqueueLocked(d)
+}
+
+// enqueueLocked is enqueue with mu held.
+func (n *webhookNotifier) enqueueLocked(d webhookDelivery) {
+	if n.stopped {
+		n.deadLetter(d, "notifier stopped", nil)
+		return
+	}
+	select {
+	case n.queue <- d:
+	default:
+		n.deadLetter(d, "queue full", nil)
+	}
+}
+
+// run sends queued deliveries until stopCh is closed, then keeps sending
+// those still queued or waiting for a retry for up to flushTimeout. Any left
+// after that are dead-lettered.
+func (n *webhookNotifier) run(stopCh <-chan struct{}, flushTimeout time.Duration) {
+	for {
+		select {
+		case <-stopCh:
+			n.flush(flushTimeout)
+			n.stop()
+			return
+		case d := <-n.queue:
+			n.deliver(d)
+		}
+	}
+}
+
+// flush sends deliveries until none is queued or waiting for a retry, or
+// until timeout elapses. A retry is requeued under mu as it leaves
+// retrying, so an empty queue and no retries means nothing is pending.
+func (n *webhookNotifier) flush(timeout time.Duration) {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		n.mu.Lock()
+		pending := len(n.queue) + len(n.retrying)
+		n.mu.Unlock()
+		if pending == 0 {
+			return
+		}
+		select {
+		case d := <-n.queue:
+			n.deliver(d)
+		case <-deadline.C:
+			return
+		}
+	}
+}
+
+// stop dead-letters every delivery still queued or waiting for a retry, and
+// every one queued later.
+func (n *webhookNotifier) stop() {
+	n.mu.Lock()
+	n.stopped = true
+	for id, d := range n.retrying {
+		delete(n.retrying, id)
+		n.deadLetter(d, "notifier stopped", nil)
+	}
+	n.mu.Unlock()
+	for {
+		select {
+		case d := <-n.queue:
+			n.deadLetter(d, "notifier stopped", nil)
+		default:
+			return
+		}
+	}
+}
+
+// deliver sends d once and schedules a retry or dead-letters it on failure.
+func (n *webhookNotifier) deliver(d webhookDelivery) {
+	d.attempt++
+	retry, err := n.post(d.url, d.body)
+	if err == nil {
+		d.logger.Debug("Webhook delivered", "url", d.url, "attempt", d.attempt)
+		return
+	}
+	if !retry || d.attempt >= webhookAttempts {
+		n.deadLetter(d, "delivery failed", err)
+		return
+	}
+
+	n.retry(d, err)
+}
+
+// retry requeues d once its backoff has elapsed. At most as many deliveries
+// as the queue holds wait for a retry at once; others are dead-lettered.
+func (n *webhookNotifier) retry(d webhookDelivery, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stopped {
+		n.deadLetter(d, "notifier stopped", err)
+		return
+	}
+	if len(n.retrying) >= cap(n.queue) {
+		n.deadLetter(d, "retry queue full", err)
+		return
+	}
+	id := n.nextRetry
+	n.nextRetry++
+	n.retrying[id] = d
+
+	delay := webhookBackoff << (d.attempt - 1)
+	webhookRetries.Inc()
+	d.logger.Warn("Webhook delivery failed, retrying", "url", d.url, "attempt", d.attempt, "retryIn", delay, "err", err)
+	time.AfterFunc(delay, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		// Stopping dead-letters every waiting retry
+		if _, ok := n.retrying[id]; ok {
+			delete(n.retrying, id)
+			n.enqueueLocked(d)
+		}
+	})
+}
+
+// deadLetter gives up on d and logs its full payload so it can be recovered
+// from the logs.
+func (n *webhookNotifier) deadLetter(d webhookDelivery, reason string, err error) {
+	webhookDeliveryFailures.Inc()
+	d.logger.Error("Dropping webhook notification", "url", d.url, "reason", reason, "attempts", d.attempt, "err", err,
+		"payload", string(d.body))
+}
+
+// post sends a single request and reports whether a failure is worth
+// retrying. The client's timeout bounds it.
+func (n *webhookNotifier) post(url string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook returned %s", resp.Status)
+	case resp.StatusCode >= 300:
+		return false, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return false, nil
+}
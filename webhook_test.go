@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifierFlushesOnStop(t *testing.T) {
+	// The first failures requests fail, so notifications wait out their
+	// backoff when the notifier is stopped
+	var requests, failures, delivered atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) <= failures.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		delivered.Add(1)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name          string
+		failures      int32
+		flushTimeout  time.Duration
+		wantDelivered int32
+	}{
+		{name: "flushed with a retry", failures: 1, flushTimeout: 10 * time.Second, wantDelivered: 3},
+		// The first retry is due after the timeout
+		{name: "timed out", failures: 100, flushTimeout: 100 * time.Millisecond, wantDelivered: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			failures.Store(tt.failures)
+			delivered.Store(0)
+			n := newWebhookNotifier(&http.Client{Timeout: time.Second}, 10)
+			for range 3 {
+				if err := n.notify(slog.Default(), srv.URL, webhookPayload{}); err != nil {
+					t.Fatalf("notify: %v", err)
+				}
+			}
+
+			stop := make(chan struct{})
+			close(stop)
+			start := time.Now()
+			n.run(stop, tt.flushTimeout)
+			if elapsed := time.Since(start); elapsed > tt.flushTimeout+5*time.Second {
+				t.Errorf("run returned after %s, want about %s at most", elapsed, tt.flushTimeout)
+			}
+			if got := delivered.Load(); got != tt.wantDelivered {
+				t.Errorf("delivered = %d, want %d", got, tt.wantDelivered)
+			}
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if len(n.queue) != 0 || len(n.retrying) != 0 {
+				t.Errorf("%d queued and %d retrying after run returned, want none", len(n.queue), len(n.retrying))
+			}
+		})
+	}
+}